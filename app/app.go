@@ -2,13 +2,11 @@ package app
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"io/fs"
 	"log"
 	"os"
-	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/gdamore/tcell/v2/views"
@@ -19,13 +17,18 @@ import (
 )
 
 type App struct {
-	ctx  context.Context
-	path string
+	ctx   context.Context
+	paths []string
 
 	main      *views.Panel
 	titleBar  *TitleBar
 	treemap   *TreemapWidget
 	statusBar *StatusBar
+	owners    *OwnersPanel
+	dupes     *DuplicatesPanel
+	errors    *ErrorList
+	// hasState is set once there is a treemap to draw
+	hasState bool
 
 	screen tcell.Screen
 	view   views.View
@@ -43,10 +46,11 @@ func (app *App) Run() error {
 	if err != nil {
 		return err
 	}
-	defer app.cleanup()
 
 	go app.screen.ChannelEvents(app.tcellEvents, app.ctx.Done())
 	app.loop()
+	app.cleanup()
+	app.printErrors()
 	return nil
 }
 
@@ -76,6 +80,16 @@ func (app *App) handleTcellEvent(ev tcell.Event) bool {
 func (app *App) handleKey(ev *tcell.EventKey) bool {
 	mod, key, ch := ev.Modifiers(), ev.Key(), ev.Rune()
 	log.Printf("EventKey Modifiers: %d Key: %d Rune: %d", mod, key, ch)
+	if app.errors.Visible() {
+		// the error list takes all keys but those quitting
+		if app.errors.HandleEvent(ev) {
+			app.redraw()
+			return true
+		}
+		if key != tcell.KeyCtrlC && !(key == tcell.KeyRune && ch == 'q') {
+			return true
+		}
+	}
 	var cmd dux.Command
 	switch key {
 	case tcell.KeyRune:
@@ -99,6 +113,31 @@ func (app *App) handleKey(ev *tcell.EventKey) bool {
 			cmd = dux.ZoomIn{}
 		case 'o':
 			cmd = dux.ZoomOut{}
+		// size
+		case 'a':
+			cmd = dux.ToggleSizeMode{}
+		// colors
+		case 'c':
+			cmd = dux.CycleColorMode{}
+		// sorting
+		case 's':
+			cmd = dux.CycleSortKey{}
+		// grouping
+		case 't':
+			cmd = dux.ToggleTypeView{}
+		// duplicates
+		case 'd':
+			cmd = dux.ToggleDuplicates{}
+		// rescan
+		case 'r':
+			cmd = dux.Rescan{}
+		// export
+		case 'e':
+			cmd = dux.ExportNcdu{File: exportFileName(time.Now())}
+		// errors
+		case '!':
+			app.errors.Toggle()
+			app.redraw()
 		// misc
 		case ' ':
 			cmd = dux.TogglePause{}
@@ -137,6 +176,12 @@ func (app *App) handleKey(ev *tcell.EventKey) bool {
 	return true
 }
 
+// exportFileName returns the name of a new ncdu export in the current
+// directory
+func exportFileName(now time.Time) string {
+	return "dux-" + now.Format("20060102-150405") + ".json"
+}
+
 func (app *App) handleMouse(ev *tcell.EventMouse) bool {
 	mx, my := ev.Position()
 	log.Printf("EventMouse Buttons: %#b Modifiers: %#b Position: (%d, %d)", ev.Buttons(), ev.Modifiers(), mx, my)
@@ -162,13 +207,59 @@ func (app *App) handleMouse(ev *tcell.EventMouse) bool {
 func (app *App) SetState(state dux.State) {
 	app.titleBar.SetState(state)
 	app.treemap.SetState(state)
+	app.owners.SetState(state)
+	app.dupes.SetState(state)
 }
 
 func (app *App) Draw() {
 	app.widget.Draw()
+	app.drawPanels()
+	app.drawErrors()
 	app.screen.Show()
 }
 
+// redraw draws the app again, once there is something to draw
+func (app *App) redraw() {
+	if app.hasState {
+		app.Draw()
+	}
+}
+
+// panel is a widget drawn over the treemap when visible
+type panel interface {
+	views.Widget
+	Visible() bool
+}
+
+// drawPanels draws the visible panels over the right side of the treemap,
+// one below the other
+func (app *App) drawPanels() {
+	w, _ := app.view.Size()
+	_, y := app.titleBar.Size()
+	for _, p := range []panel{app.owners, app.dupes} {
+		if !p.Visible() {
+			continue
+		}
+		pw, ph := p.Size()
+		p.SetView(views.NewViewPort(app.view, w-pw, y, pw, ph))
+		p.Draw()
+		y += ph
+	}
+}
+
+// drawErrors draws the error list over the treemap, leaving a margin
+func (app *App) drawErrors() {
+	if !app.errors.Visible() {
+		return
+	}
+	const margin = 2
+	w, _ := app.view.Size()
+	_, th := app.titleBar.Size()
+	_, tmh := app.treemap.Size()
+	app.errors.SetView(views.NewViewPort(app.view, margin, th+1, maxInt(w-2*margin, 1), maxInt(tmh-2, 1)))
+	app.errors.Draw()
+}
+
 func (app *App) refresh() {
 	app.screen.Sync()
 }
@@ -237,10 +328,15 @@ func (app *App) handleStateEvent(event dux.StateEvent) (quit bool) {
 		app.closeTcellEventChannel()
 		return true
 	}
-	app.printErrors(event.Errors)
+	for _, path := range event.Replaced {
+		app.errors.Prune(path)
+	}
+	app.errors.Add(event.Errors)
+	app.statusBar.SetErrorCount(app.errors.Len())
 
 	if event.State.Treemap != nil {
 		app.SetState(event.State)
+		app.hasState = true
 		app.Draw()
 	}
 
@@ -305,35 +401,18 @@ func (app *App) cleanupAndRepanic() {
 	}
 }
 
-// printErrors prints error messages to stderr in the Normal Screen Buffer. The
-// error messages will be visible when the application is closed or
-// backgrounded, as well as during a brief flicker which occurs when the
-// Alternate Screen Buffer is disabled to allow writing to the normal screen
-// buffer.
+// printErrors prints the messages of all errors to stderr in the Normal Screen
+// Buffer, after the Alternate Screen Buffer is closed, so that they stay in the
+// scrollback buffer once the application has quit.
 //
 // For more info, see:
 // - https://stackoverflow.com/questions/39188508/how-curses-preserves-screen-contents
 // - https://invisible-island.net/xterm/ctlseqs/ctlseqs.html#h2-The-Alternate-Screen-Buffer
 // - https://invisible-island.net/xterm/xterm.faq.html#xterm_tite
-func (app *App) printErrors(errs []error) {
-	if len(errs) == 0 {
-		return
-	}
-
-	var msgs []string = make([]string, len(errs))
-	for i, err := range errs {
-		var perr *fs.PathError
-		if errors.As(err, &perr) {
-			msgs[i] = fmt.Sprintf("cannot access '%s': %v", perr.Path, perr.Err)
-		} else {
-			msgs[i] = err.Error()
-		}
+func (app *App) printErrors() {
+	for _, msg := range app.errors.Messages() {
+		fmt.Fprintln(os.Stderr, msg)
 	}
-	lines := strings.Join(msgs, "\n")
-
-	app.Suspend()
-	fmt.Fprintln(os.Stderr, lines)
-	app.Resume()
 }
 
 func (app *App) clearAlternateScreen() {
@@ -360,7 +439,7 @@ func (app *App) resumeFromBackground() {
 	app.Draw()
 }
 
-func NewApp(ctx context.Context, path string, stateEvents <-chan dux.StateEvent, commands chan<- dux.Command) *App {
+func NewApp(ctx context.Context, paths []string, stateEvents <-chan dux.StateEvent, commands chan<- dux.Command) *App {
 	tv := NewTreemapWidget(commands)
 	title := NewTitleBar(commands)
 	status := NewStatusBar(commands)
@@ -371,12 +450,15 @@ func NewApp(ctx context.Context, path string, stateEvents <-chan dux.StateEvent,
 	main.SetStatus(status)
 
 	app := &App{
-		path:        path,
+		paths:       paths,
 		main:        main,
 		widget:      main,
 		titleBar:    title,
 		statusBar:   status,
 		treemap:     tv,
+		owners:      NewOwnersPanel(),
+		dupes:       NewDuplicatesPanel(),
+		errors:      NewErrorList(),
 		stateEvents: stateEvents,
 		commands:    commands,
 		tcellEvents: make(chan tcell.Event),
@@ -4,54 +4,269 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
+
+	"github.com/jensgreen/dux/files"
 )
 
+// Args are the command line parameters of the program
+type Args struct {
+	Paths          []string
+	Debug          bool
+	Jobs           int
+	SizeMode       files.SizeMode
+	CountLinks     bool
+	OneFileSystem  bool
+	Exclude        *files.Patterns
+	GitIgnore      bool
+	FollowSymlinks bool
+	Watch          bool
+	Save           string
+	Load           string
+	ImportNcdu     string
+	ExportNcdu     string
+	FromDu         string
+	DuBlockSize    int64
+	DuDirsOnly     bool
+	MaxIOPS        int
+	SummarizeBelow int
+	SortKey        files.SortKey
+}
+
+// niceIOPS is the rate of I/O operations of --nice
+const niceIOPS = 200
+
+// sources returns the options given to read files from other than by scanning
+func (a Args) sources() []string {
+	var sources []string
+	if a.Load != "" {
+		sources = append(sources, "--load")
+	}
+	if a.ImportNcdu != "" {
+		sources = append(sources, "--import-ncdu")
+	}
+	if a.FromDu != "" {
+		sources = append(sources, "--from-du")
+	}
+	return sources
+}
+
+// IsScanning reports whether files are read by scanning Paths
+func (a Args) IsScanning() bool {
+	return len(a.sources()) == 0
+}
+
 func printUsage(w io.Writer) {
-	usage := "Usage: %s [--help] [DIRECTORY]\n"
+	usage := "Usage: %s [OPTION]... [FILE]...\n"
 	_, _ = fmt.Fprintf(w, usage, os.Args[0])
 }
 
 func printHelp(w io.Writer) {
 	printUsage(w)
-	desc := "Visually summarize disk usage of DIRECTORY (the current directory by default).\n"
+	desc := "Visually summarize disk usage of each FILE, recursively for directories\n"
+	desc += "(the current directory by default).\n"
 	desc += "\n"
 	desc += "Options:\n"
-	desc += "      --help     display this help and exit\n"
-	fmt.Fprintln(w, desc)
+	desc += "      --apparent-size       print apparent sizes rather than disk usage\n"
+	desc += "  -L, --follow-symlinks     follow all symbolic links\n"
+	desc += "  -l, --count-links         count sizes many times if hard linked\n"
+	desc += "  -x, --one-file-system     skip directories on different file systems\n"
+	desc += "      --exclude=PATTERN     skip files matching PATTERN, using .gitignore syntax\n"
+	desc += "      --exclude-from=FILE   skip files matching any pattern in FILE\n"
+	desc += "      --gitignore           skip files ignored by .gitignore files found\n"
+	desc += "  -w, --watch               keep watching for changes after scanning (Linux only)\n"
+	desc += "      --save=FILE           save the scan to a snapshot FILE\n"
+	desc += "      --load=FILE           show a snapshot FILE instead of scanning\n"
+	desc += "      --import-ncdu=FILE    show an ncdu JSON export FILE, or - for stdin\n"
+	desc += "      --export-ncdu=FILE    write the scan to FILE as an ncdu JSON export\n"
+	desc += "      --from-du=FILE        show the output of du -a in FILE, or - for stdin\n"
+	desc += "      --du-block-size=SIZE  du sizes are in units of SIZE bytes (default: 1,\n"
+	desc += "                            use 1024 for du -k)\n"
+	desc += "      --du-dirs-only        du output lists only directories, as without -a;\n"
+	desc += "                            otherwise paths without children are files\n"
+	desc += "      --nice                scan gently, like --max-iops=%d\n"
+	desc += "      --max-iops=N          read at most N directories or file infos per second\n"
+	desc += "      --sort=KEY            order tiles by KEY: size (default), name or mtime\n"
+	desc += "      --summarize-below=N   keep only the total size of files more than N levels\n"
+	desc += "                            deep in each directory, to save memory\n"
+	desc += "  -j, --jobs=N              read up to N directories concurrently (default: number of CPUs)\n"
+	desc += "      --help                display this help and exit\n"
+	fmt.Fprintf(w, desc+"\n", niceIOPS)
 }
 
 // ArgsOrExit returns valid parameters, or, on either --help or invalid input, exits the program
-func ArgsOrExit() (path string, debug bool) {
+func ArgsOrExit() Args {
 	var (
 		args       []string = os.Args[1:]
 		help       bool
 		unknownOpt string
+		invalidArg string
+		parsed     = Args{Jobs: runtime.NumCPU(), Exclude: &files.Patterns{}, DuBlockSize: 1}
 	)
 
-	for _, arg := range args {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		// value returns the value of an option given either as "--opt=value"
+		// or as "--opt value"
+		value := func() (string, bool) {
+			if _, v, ok := strings.Cut(arg, "="); ok {
+				return v, true
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i], true
+			}
+			return "", false
+		}
+
 		switch {
 		case arg == "--help":
 			help = true
 		case arg == "--debug":
-			debug = true
+			parsed.Debug = true
+		case arg == "--apparent-size":
+			parsed.SizeMode = files.ApparentSize
+		case arg == "-L" || arg == "--follow-symlinks":
+			parsed.FollowSymlinks = true
+		case arg == "-l" || arg == "--count-links":
+			parsed.CountLinks = true
+		case arg == "-x" || arg == "--one-file-system":
+			parsed.OneFileSystem = true
+		case arg == "--exclude" || strings.HasPrefix(arg, "--exclude="):
+			v, ok := value()
+			if !ok {
+				invalidArg = "option requires an argument: --exclude"
+			}
+			parsed.Exclude.Add(v, "")
+		case arg == "--exclude-from" || strings.HasPrefix(arg, "--exclude-from="):
+			v, ok := value()
+			if !ok {
+				invalidArg = "option requires an argument: --exclude-from"
+			} else if err := addPatternsFrom(parsed.Exclude, v); err != nil {
+				invalidArg = fmt.Sprintf("cannot read patterns from '%s': %v", v, err)
+			}
+		case arg == "--gitignore":
+			parsed.GitIgnore = true
+		case arg == "-w" || arg == "--watch":
+			parsed.Watch = true
+		case arg == "--save" || strings.HasPrefix(arg, "--save="):
+			v, ok := value()
+			if !ok || v == "" {
+				invalidArg = "option requires an argument: --save"
+			}
+			parsed.Save = v
+		case arg == "--load" || strings.HasPrefix(arg, "--load="):
+			v, ok := value()
+			if !ok || v == "" {
+				invalidArg = "option requires an argument: --load"
+			}
+			parsed.Load = v
+		case arg == "--import-ncdu" || strings.HasPrefix(arg, "--import-ncdu="):
+			v, ok := value()
+			if !ok || v == "" {
+				invalidArg = "option requires an argument: --import-ncdu"
+			}
+			parsed.ImportNcdu = v
+		case arg == "--export-ncdu" || strings.HasPrefix(arg, "--export-ncdu="):
+			v, ok := value()
+			if !ok || v == "" {
+				invalidArg = "option requires an argument: --export-ncdu"
+			}
+			parsed.ExportNcdu = v
+		case arg == "--from-du" || strings.HasPrefix(arg, "--from-du="):
+			v, ok := value()
+			if !ok || v == "" {
+				invalidArg = "option requires an argument: --from-du"
+			}
+			parsed.FromDu = v
+		case arg == "--du-block-size" || strings.HasPrefix(arg, "--du-block-size="):
+			v, ok := value()
+			n, err := strconv.ParseInt(v, 10, 64)
+			if !ok || err != nil || n < 1 {
+				invalidArg = fmt.Sprintf("invalid block size: '%s'", v)
+			}
+			parsed.DuBlockSize = n
+		case arg == "--du-dirs-only":
+			parsed.DuDirsOnly = true
+		case arg == "--nice":
+			if parsed.MaxIOPS == 0 {
+				parsed.MaxIOPS = niceIOPS
+			}
+		case arg == "--max-iops" || strings.HasPrefix(arg, "--max-iops="):
+			v, ok := value()
+			n, err := strconv.Atoi(v)
+			if !ok || err != nil || n < 1 {
+				invalidArg = fmt.Sprintf("invalid number of I/O operations per second: '%s'", v)
+			}
+			parsed.MaxIOPS = n
+		case arg == "--sort" || strings.HasPrefix(arg, "--sort="):
+			v, ok := value()
+			key, valid := files.ParseSortKey(v)
+			if !ok || !valid {
+				invalidArg = fmt.Sprintf("invalid sort key: '%s'", v)
+			}
+			parsed.SortKey = key
+		case arg == "--summarize-below" || strings.HasPrefix(arg, "--summarize-below="):
+			v, ok := value()
+			n, err := strconv.Atoi(v)
+			if !ok || err != nil || n < 1 {
+				invalidArg = fmt.Sprintf("invalid depth: '%s'", v)
+			}
+			parsed.SummarizeBelow = n
+		case arg == "-j" || arg == "--jobs" || strings.HasPrefix(arg, "--jobs="):
+			v, ok := value()
+			n, err := strconv.Atoi(v)
+			if !ok || err != nil || n < 1 {
+				invalidArg = fmt.Sprintf("invalid number of jobs: '%s'", v)
+			}
+			parsed.Jobs = n
 		case strings.HasPrefix(arg, "--"):
 			unknownOpt = arg
 		default:
-			path = arg
+			parsed.Paths = append(parsed.Paths, arg)
 		}
 
-		if exit, code := maybeExit(unknownOpt, help); exit {
+		if exit, code := maybeExit(unknownOpt, invalidArg, help); exit {
 			os.Exit(code)
 		}
 	}
-	if path == "" {
-		path = "."
+	if sources := parsed.sources(); len(sources) > 0 {
+		var invalidArg string
+		if len(sources) > 1 {
+			invalidArg = fmt.Sprintf("cannot combine %s", strings.Join(sources, " and "))
+		} else if len(parsed.Paths) > 0 {
+			invalidArg = fmt.Sprintf("cannot both use %s and scan FILE", sources[0])
+		} else if parsed.Watch {
+			invalidArg = fmt.Sprintf("cannot watch files read with %s", sources[0])
+		}
+		if exit, code := maybeExit("", invalidArg, false); exit {
+			os.Exit(code)
+		}
+	}
+	if parsed.Watch && parsed.SummarizeBelow > 0 {
+		// changes to summarized files cannot be told apart
+		if exit, code := maybeExit("", "cannot watch files summarized with --summarize-below", false); exit {
+			os.Exit(code)
+		}
 	}
-	return path, debug
+	if len(parsed.Paths) == 0 && parsed.IsScanning() {
+		parsed.Paths = []string{"."}
+	}
+	return parsed
+}
+
+func addPatternsFrom(patterns *files.Patterns, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return patterns.AddFrom(f, "")
 }
 
-func maybeExit(unknownOpt string, help bool) (exit bool, code int) {
+func maybeExit(unknownOpt string, invalidArg string, help bool) (exit bool, code int) {
 	switch {
 	case unknownOpt != "":
 		// mimic `git --a` unknown opt behavior:
@@ -59,6 +274,10 @@ func maybeExit(unknownOpt string, help bool) (exit bool, code int) {
 		fmt.Fprintln(os.Stderr, "unknown option: "+unknownOpt)
 		printUsage(os.Stderr)
 		return true, 1
+	case invalidArg != "":
+		fmt.Fprintln(os.Stderr, invalidArg)
+		printUsage(os.Stderr)
+		return true, 1
 	case help:
 		printHelp(os.Stdout)
 		return true, 0
@@ -64,6 +64,7 @@ var boxCharsDouble = boxChars{
 
 type Box struct {
 	isSelected bool
+	color      tcell.Color
 	view       views.View
 
 	views.WidgetWatchers
@@ -120,11 +121,16 @@ func (b *Box) Select(isSelected bool) {
 	b.isSelected = isSelected
 }
 
+// SetColor sets the color of the lines when not selected
+func (b *Box) SetColor(color tcell.Color) {
+	b.color = color
+}
+
 func (b *Box) style() tcell.Style {
 	if b.isSelected {
 		return tcell.StyleDefault.Foreground(tcell.ColorYellow)
 	}
-	return tcell.StyleDefault
+	return tcell.StyleDefault.Foreground(b.color)
 }
 
 func (b *Box) boxChars() boxChars {
@@ -0,0 +1,180 @@
+package app
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/jensgreen/dux/dux"
+	"github.com/jensgreen/dux/files"
+)
+
+const day = 24 * time.Hour
+
+// ageColors shade from fresh to stale, each up to an age
+var ageColors = []struct {
+	maxAge time.Duration
+	color  tcell.Color
+}{
+	{day, tcell.ColorLime},
+	{7 * day, tcell.ColorGreen},
+	{30 * day, tcell.ColorYellowGreen},
+	{182 * day, tcell.ColorYellow},
+	{365 * day, tcell.ColorOrange},
+	{3 * 365 * day, tcell.ColorOrangeRed},
+	{10 * 365 * day, tcell.ColorRed},
+}
+
+// ageColor returns the color of something last modified at t, as of now
+func ageColor(t time.Time, now time.Time) tcell.Color {
+	if t.IsZero() {
+		return tcell.ColorGray
+	}
+	age := now.Sub(t)
+	for _, c := range ageColors {
+		if age < c.maxAge {
+			return c.color
+		}
+	}
+	return tcell.ColorDarkRed
+}
+
+// ownerColors tell the top owners apart, most first
+var ownerColors = []tcell.Color{
+	tcell.ColorRed,
+	tcell.ColorLime,
+	tcell.ColorYellow,
+	tcell.ColorBlue,
+	tcell.ColorFuchsia,
+	tcell.ColorAqua,
+	tcell.ColorOrange,
+	tcell.ColorPurple,
+}
+
+// otherOwnersColor is the color of owners not among the top owners
+const otherOwnersColor = tcell.ColorSilver
+
+// ownerColor returns the color of the user with uid, given the top owners
+func ownerColor(uid uint32, owners []files.OwnerUsage) tcell.Color {
+	for i, u := range owners {
+		if u.UID == uid && i < len(ownerColors) {
+			return ownerColors[i]
+		}
+	}
+	return otherOwnersColor
+}
+
+// copyColor highlights the copies of the selected file
+const copyColor = tcell.ColorHotPink
+
+// errorColor marks what could not be read completely, in every color mode
+const errorColor = tcell.ColorRed
+
+// colorScheme colors tiles by what a ColorMode shows
+type colorScheme struct {
+	mode dux.ColorMode
+	// now is the time as of which ages are colored
+	now time.Time
+	// owners are the top owners, as colored by ownerColor
+	owners []files.OwnerUsage
+	// copies are the paths of the selected file and its duplicates
+	copies map[string]bool
+}
+
+func newColorScheme(state dux.State) colorScheme {
+	now := state.SnapshotTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	cs := colorScheme{mode: state.ColorMode, now: now, owners: state.TopOwners}
+	if state.Selection != nil {
+		if set, ok := state.Duplicates.SetOf(state.Selection.Path()); ok {
+			cs.copies = make(map[string]bool, len(set.Paths))
+			for _, path := range set.Paths {
+				cs.copies[path] = true
+			}
+		}
+	}
+	return cs
+}
+
+// tileColor returns the color of the tile of f, or tcell.ColorDefault for
+// the colors of its type
+func (cs colorScheme) tileColor(f files.File) tcell.Color {
+	if cs.copies[f.Path] {
+		return copyColor
+	}
+	if f.NumErrors > 0 {
+		return errorColor
+	}
+	switch cs.mode {
+	case dux.ColorByAge:
+		return ageColor(f.NewestModTime, cs.now)
+	case dux.ColorByOwner:
+		if !f.HasOwner {
+			return tcell.ColorGray
+		}
+		return ownerColor(f.MainUID, cs.owners)
+	}
+	return tcell.ColorDefault
+}
+
+// describe returns what the color of the tile of f shows, or "" if nothing
+// more than its type
+func (cs colorScheme) describe(f files.File) string {
+	switch cs.mode {
+	case dux.ColorByAge:
+		if f.NewestModTime.IsZero() {
+			return ""
+		}
+		age := cs.now.Sub(f.NewestModTime)
+		if age < 0 {
+			// modified in the future, by a skewed clock
+			age = 0
+		}
+		return humanizeAge(age) + " old"
+	case dux.ColorByOwner:
+		if !f.HasOwner {
+			return ""
+		}
+		return ownerName(f.MainUID)
+	}
+	return ""
+}
+
+var (
+	ownerNamesMu sync.Mutex
+	ownerNames   = make(map[uint32]string)
+)
+
+// ownerName returns the name of the user with uid, or the uid if unknown
+func ownerName(uid uint32) string {
+	ownerNamesMu.Lock()
+	defer ownerNamesMu.Unlock()
+	if name, ok := ownerNames[uid]; ok {
+		return name
+	}
+	id := strconv.FormatUint(uint64(uid), 10)
+	name := id
+	if u, err := user.LookupId(id); err == nil {
+		name = u.Username
+	}
+	ownerNames[uid] = name
+	return name
+}
+
+// humanizeAge returns an approximate age, such as "5d" or "3y"
+func humanizeAge(age time.Duration) string {
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age/time.Minute))
+	case age < day:
+		return fmt.Sprintf("%dh", int(age/time.Hour))
+	case age < 365*day:
+		return fmt.Sprintf("%dd", int(age/day))
+	}
+	return fmt.Sprintf("%dy", int(age/(365*day)))
+}
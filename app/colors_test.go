@@ -0,0 +1,52 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/jensgreen/dux/dux"
+	"github.com/jensgreen/dux/files"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AgeColorShadesFromFreshToStale(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, tcell.ColorLime, ageColor(now.Add(-time.Hour), now))
+	assert.Equal(t, tcell.ColorYellow, ageColor(now.AddDate(0, -2, 0), now))
+	assert.Equal(t, tcell.ColorRed, ageColor(now.AddDate(-5, 0, 0), now))
+	assert.Equal(t, tcell.ColorDarkRed, ageColor(now.AddDate(-20, 0, 0), now))
+	assert.Equal(t, tcell.ColorGray, ageColor(time.Time{}, now), "unknown")
+}
+
+func Test_TileColorByAgeUsesNewestModTime(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	dir := files.File{Path: "d", IsDir: true, ModTime: now.AddDate(-20, 0, 0), NewestModTime: now}
+
+	assert.Equal(t, tcell.ColorLime, colorScheme{mode: dux.ColorByAge, now: now}.tileColor(dir))
+	assert.Equal(t, tcell.ColorDefault, colorScheme{mode: dux.ColorByType, now: now}.tileColor(dir))
+}
+
+func Test_TileColorByOwnerUsesRankOfMainOwner(t *testing.T) {
+	colors := colorScheme{mode: dux.ColorByOwner, owners: []files.OwnerUsage{{UID: 1001}, {UID: 1000}}}
+
+	assert.Equal(t, ownerColors[1], colors.tileColor(files.File{MainUID: 1000, HasOwner: true}))
+	assert.Equal(t, otherOwnersColor, colors.tileColor(files.File{MainUID: 7, HasOwner: true}))
+	assert.Equal(t, tcell.ColorGray, colors.tileColor(files.File{}), "unknown owner")
+}
+
+func Test_HumanizeAge(t *testing.T) {
+	assert.Equal(t, "5m", humanizeAge(5*time.Minute))
+	assert.Equal(t, "3h", humanizeAge(3*time.Hour+time.Minute))
+	assert.Equal(t, "40d", humanizeAge(40*day))
+	assert.Equal(t, "2y", humanizeAge(800*day))
+}
+
+func Test_TileColorOfErrorsInEveryColorMode(t *testing.T) {
+	dir := files.File{Path: "d", IsDir: true, NumErrors: 1}
+
+	for _, mode := range []dux.ColorMode{dux.ColorByType, dux.ColorByAge, dux.ColorByOwner} {
+		assert.Equal(t, errorColor, colorScheme{mode: mode}.tileColor(dir), "coloring by %v", mode)
+	}
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/gdamore/tcell/v2/views"
+	"github.com/jensgreen/dux/dux"
+	"github.com/jensgreen/dux/files"
+)
+
+// maxDuplicateLines is how many of the most wasteful duplicate sets are listed
+const maxDuplicateLines = 10
+
+// DuplicatesPanel lists the duplicate sets wasting the most space, marking
+// the one of the selected file
+type DuplicatesPanel struct {
+	visible bool
+	lines   []panelLine
+
+	view views.View
+	box  *Box
+
+	views.WidgetWatchers
+}
+
+func (dp *DuplicatesPanel) SetState(state dux.State) {
+	dp.visible = state.FindDuplicates && state.Duplicates != nil
+	var selection string
+	if state.Selection != nil {
+		selection = state.Selection.Path()
+	}
+	dp.update(state.Duplicates, state.IsHashing, selection)
+}
+
+// Visible reports whether there is anything to show
+func (dp *DuplicatesPanel) Visible() bool {
+	return dp.visible
+}
+
+func (dp *DuplicatesPanel) update(dupes *files.Duplicates, isHashing bool, selection string) {
+	dp.lines = dp.lines[:0]
+	if dupes == nil {
+		return
+	}
+	summary := fmt.Sprintf("%d sets, %s wasted", len(dupes.Sets), files.HumanizeIEC(dupes.TotalWasted()))
+	if isHashing {
+		summary += ", hashing"
+	}
+	dp.lines = append(dp.lines, panelLine{mark: ' ', text: summary})
+
+	selected, _ := dupes.SetOf(selection)
+	for i, set := range dupes.Sets {
+		if i == maxDuplicateLines {
+			break
+		}
+		line := panelLine{
+			mark: '·',
+			text: fmt.Sprintf("%d× %s %s", len(set.Paths), files.HumanizeIEC(set.Size), filepath.Base(set.Paths[0])),
+		}
+		if len(selected.Paths) > 0 && set.Paths[0] == selected.Paths[0] {
+			line.mark, line.color = '●', copyColor
+		}
+		dp.lines = append(dp.lines, line)
+	}
+}
+
+func (dp *DuplicatesPanel) Draw() {
+	if !dp.visible || dp.view == nil {
+		return
+	}
+	drawPanel(dp.view, dp.box, "duplicates", dp.lines)
+}
+
+func (dp *DuplicatesPanel) Resize() {
+	dp.PostEventWidgetResize(dp)
+}
+
+func (dp *DuplicatesPanel) HandleEvent(ev tcell.Event) bool {
+	return false
+}
+
+func (dp *DuplicatesPanel) SetView(view views.View) {
+	dp.view = view
+}
+
+// Size returns the size needed to show the listed sets in a box
+func (dp *DuplicatesPanel) Size() (int, int) {
+	return panelSize("duplicates", dp.lines)
+}
+
+func NewDuplicatesPanel() *DuplicatesPanel {
+	return &DuplicatesPanel{box: NewBox()}
+}
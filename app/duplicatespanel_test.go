@@ -0,0 +1,40 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jensgreen/dux/app/testutil"
+	"github.com/jensgreen/dux/dux"
+	"github.com/jensgreen/dux/files"
+	"github.com/jensgreen/dux/treemap"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DuplicatesPanelMarksSetOfSelection(t *testing.T) {
+	state := dux.State{
+		FindDuplicates: true,
+		Duplicates: files.NewDuplicates([]files.DuplicateSet{
+			{Size: 2048, Paths: []string{"a/x.iso", "b/x.iso", "c/x.iso"}},
+			{Size: 10, Paths: []string{"a/y", "b/y"}},
+		}),
+		Selection: &treemap.R2Treemap{File: files.File{Path: "b/y"}},
+	}
+	dp := NewDuplicatesPanel()
+	dp.SetState(state)
+	w, h := dp.Size()
+	screen := testutil.InitSimScreen(t, w, h)
+	dp.SetView(screen)
+	dp.Draw()
+
+	got := testutil.ScreenToString(screen)
+	want := strings.TrimSpace(`
+┌ duplicates ─────────┐
+│  2 sets, 4.0K wasted│
+│· 3× 2.0K x.iso      │
+│● 2× 10B y           │
+└─────────────────────┘
+`)
+
+	assert.Equal(t, want, got, "output differs")
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/gdamore/tcell/v2/views"
+	"github.com/jensgreen/dux/files"
+)
+
+// ErrorList is a scrollable list of the errors that occurred, shown over the
+// treemap on demand
+type ErrorList struct {
+	// errs are in the order they occurred, at most one per path
+	errs []listedError
+	// index is the position in errs of the error about each path
+	index   map[string]int
+	offset  int
+	visible bool
+
+	view views.View
+	box  *Box
+
+	views.WidgetWatchers
+}
+
+// listedError is the message of an error about path, or about no path in
+// particular if empty
+type listedError struct {
+	path string
+	msg  string
+}
+
+// errorPath returns the path err is about, or "" if none
+func errorPath(err error) string {
+	var perr *fs.PathError
+	if errors.As(err, &perr) {
+		return perr.Path
+	}
+	return ""
+}
+
+// errorMessage returns a message about err like those of du
+func errorMessage(err error) string {
+	var perr *fs.PathError
+	if errors.As(err, &perr) {
+		return fmt.Sprintf("cannot access '%s': %v", perr.Path, perr.Err)
+	}
+	return err.Error()
+}
+
+// Add appends errs to the list. An error about a path replaces an earlier
+// one about the same path.
+func (el *ErrorList) Add(errs []error) {
+	for _, err := range errs {
+		e := listedError{path: errorPath(err), msg: errorMessage(err)}
+		if i, ok := el.index[e.path]; ok {
+			el.errs[i] = e
+			continue
+		}
+		if e.path != "" {
+			el.index[e.path] = len(el.errs)
+		}
+		el.errs = append(el.errs, e)
+	}
+}
+
+// Prune removes the errors about dir and the files below it, whose subtree
+// has been replaced or removed
+func (el *ErrorList) Prune(dir string) {
+	kept := el.errs[:0]
+	for _, e := range el.errs {
+		if e.path == "" || !files.IsWithin(e.path, dir) {
+			kept = append(kept, e)
+		}
+	}
+	el.errs = kept
+	el.index = make(map[string]int, len(kept))
+	for i, e := range el.errs {
+		if e.path != "" {
+			el.index[e.path] = i
+		}
+	}
+	el.clamp()
+}
+
+// Messages returns the messages of all errors listed
+func (el *ErrorList) Messages() []string {
+	msgs := make([]string, len(el.errs))
+	for i, e := range el.errs {
+		msgs[i] = e.msg
+	}
+	return msgs
+}
+
+// Len returns the number of errors listed
+func (el *ErrorList) Len() int {
+	return len(el.errs)
+}
+
+// Visible reports whether the list is shown
+func (el *ErrorList) Visible() bool {
+	return el.visible
+}
+
+// Toggle shows or hides the list
+func (el *ErrorList) Toggle() {
+	el.visible = !el.visible
+}
+
+// Scroll moves the list by lines, up if negative
+func (el *ErrorList) Scroll(lines int) {
+	el.offset += lines
+	el.clamp()
+}
+
+// PageSize returns the number of errors shown at once
+func (el *ErrorList) PageSize() int {
+	if el.view == nil {
+		return 1
+	}
+	_, h := el.view.Size()
+	// borders
+	return maxInt(h-2, 1)
+}
+
+func (el *ErrorList) clamp() {
+	if last := len(el.errs) - el.PageSize(); el.offset > last {
+		el.offset = last
+	}
+	if el.offset < 0 {
+		el.offset = 0
+	}
+}
+
+func (el *ErrorList) Draw() {
+	if !el.visible || el.view == nil {
+		return
+	}
+	el.clamp()
+	var lines []panelLine
+	end := el.offset + el.PageSize()
+	if end > len(el.errs) {
+		end = len(el.errs)
+	}
+	for _, e := range el.errs[el.offset:end] {
+		lines = append(lines, panelLine{mark: '•', color: errorColor, text: e.msg})
+	}
+	title := "no errors"
+	if len(el.errs) > 0 {
+		title = fmt.Sprintf("errors %d-%d of %d", el.offset+1, end, len(el.errs))
+	}
+	drawPanel(el.view, el.box, title, lines)
+}
+
+func (el *ErrorList) Resize() {
+	el.PostEventWidgetResize(el)
+}
+
+// HandleEvent scrolls the list on keys when shown, and closes it on escape
+func (el *ErrorList) HandleEvent(ev tcell.Event) bool {
+	kev, ok := ev.(*tcell.EventKey)
+	if !ok || !el.visible {
+		return false
+	}
+	switch kev.Key() {
+	case tcell.KeyUp:
+		el.Scroll(-1)
+	case tcell.KeyDown:
+		el.Scroll(1)
+	case tcell.KeyPgUp:
+		el.Scroll(-el.PageSize())
+	case tcell.KeyPgDn:
+		el.Scroll(el.PageSize())
+	case tcell.KeyHome:
+		el.Scroll(-len(el.errs))
+	case tcell.KeyEnd:
+		el.Scroll(len(el.errs))
+	case tcell.KeyEscape:
+		el.Toggle()
+	case tcell.KeyRune:
+		switch kev.Rune() {
+		case 'k':
+			el.Scroll(-1)
+		case 'j':
+			el.Scroll(1)
+		case '!':
+			el.Toggle()
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (el *ErrorList) SetView(view views.View) {
+	el.view = view
+}
+
+func (el *ErrorList) Size() (int, int) {
+	if el.view == nil {
+		return 0, 0
+	}
+	return el.view.Size()
+}
+
+func NewErrorList() *ErrorList {
+	return &ErrorList{box: NewBox(), index: make(map[string]int)}
+}
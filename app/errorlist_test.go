@@ -0,0 +1,75 @@
+package app
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/jensgreen/dux/app/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ErrorListScrollsWithinErrors(t *testing.T) {
+	el := NewErrorList()
+	el.Add([]error{
+		&fs.PathError{Op: "open", Path: "a", Err: syscall.EACCES},
+		errors.New("b failed"),
+		errors.New("c failed"),
+	})
+	el.Toggle()
+	screen := testutil.InitSimScreen(t, 30, 4)
+	el.SetView(screen)
+
+	el.HandleEvent(tcell.NewEventKey(tcell.KeyEnd, 0, tcell.ModNone))
+	el.Draw()
+
+	got := testutil.ScreenToString(screen)
+	want := strings.TrimSpace(`
+┌ errors 2-3 of 3 ───────────┐
+│• b failed                  │
+│• c failed                  │
+└────────────────────────────┘
+`)
+	assert.Equal(t, want, got, "output differs")
+
+	el.Scroll(-10)
+	assert.Equal(t, 0, el.offset)
+	assert.Equal(t, "cannot access 'a': permission denied", el.Messages()[0])
+}
+
+func Test_ErrorListKeepsOneErrorPerPath(t *testing.T) {
+	el := NewErrorList()
+	el.Add([]error{
+		&fs.PathError{Op: "open", Path: "/a", Err: syscall.EACCES},
+		errors.New("inotify: event queue overflowed"),
+	})
+	el.Add([]error{&fs.PathError{Op: "open", Path: "/a", Err: syscall.EIO}})
+
+	assert.Equal(t, []string{
+		"cannot access '/a': input/output error",
+		"inotify: event queue overflowed",
+	}, el.Messages())
+}
+
+func Test_ErrorListPrunesReplacedSubtree(t *testing.T) {
+	el := NewErrorList()
+	el.Add([]error{
+		&fs.PathError{Op: "open", Path: "/a/b", Err: syscall.EACCES},
+		&fs.PathError{Op: "open", Path: "/a/b/c", Err: syscall.EACCES},
+		&fs.PathError{Op: "open", Path: "/a/bc", Err: syscall.EACCES},
+		errors.New("inotify: event queue overflowed"),
+	})
+
+	el.Prune("/a/b")
+	assert.Equal(t, 2, el.Len())
+	assert.Equal(t, "cannot access '/a/bc': permission denied", el.Messages()[0])
+
+	// the error about a path pruned is listed again if it recurs
+	el.Add([]error{&fs.PathError{Op: "open", Path: "/a/b", Err: syscall.EACCES}})
+	assert.Equal(t, 3, el.Len())
+	el.Add([]error{&fs.PathError{Op: "open", Path: "/a/bc", Err: syscall.EACCES}})
+	assert.Equal(t, 3, el.Len())
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
@@ -10,6 +11,9 @@ import (
 
 type FileLabel struct {
 	file       files.File
+	sizeMode   files.SizeMode
+	colors     colorScheme
+	wasted     int64
 	isRoot     bool
 	isSelected bool
 
@@ -66,6 +70,22 @@ func (fl *FileLabel) SetFile(file files.File) {
 	fl.update()
 }
 
+func (fl *FileLabel) SetSizeMode(mode files.SizeMode) {
+	fl.sizeMode = mode
+	fl.update()
+}
+
+func (fl *FileLabel) SetColorScheme(colors colorScheme) {
+	fl.colors = colors
+	fl.update()
+}
+
+// SetWasted sets the bytes taken up by duplicates within the file
+func (fl *FileLabel) SetWasted(wasted int64) {
+	fl.wasted = wasted
+	fl.update()
+}
+
 func (fl *FileLabel) Select(selected bool) {
 	fl.isSelected = selected
 	fl.update()
@@ -85,14 +105,17 @@ func (fl *FileLabel) update() {
 		style = style.Italic(true).Foreground(tcell.ColorYellow).Bold(true)
 	}
 
-	if fl.isRoot {
+	switch {
+	case fl.file.IsTotal():
+		b.WriteString("total")
+	case fl.isRoot:
 		b.WriteString(fl.file.Path)
-	} else {
+	default:
 		b.WriteString(fl.file.Name())
 	}
 
 	if fl.file.IsDir {
-		if !strings.HasSuffix(fl.file.Path, "/") {
+		if !strings.HasSuffix(fl.file.Path, "/") && !fl.file.IsTotal() {
 			// avoid showing for example "/" as "//"
 			b.WriteRune('/')
 		}
@@ -100,10 +123,49 @@ func (fl *FileLabel) update() {
 			style = style.Foreground(tcell.ColorBlue)
 		}
 	}
+	if fl.file.IsSymlink {
+		b.WriteString(" → " + fl.file.LinkTarget)
+		if !fl.isSelected {
+			style = style.Foreground(tcell.ColorTeal)
+		}
+	}
+	if fl.file.Excluded != files.NotExcluded && !fl.isSelected {
+		style = style.Foreground(tcell.ColorGray)
+	}
+	color := fl.colors.tileColor(fl.file)
+	if color != tcell.ColorDefault && !fl.isSelected {
+		style = style.Foreground(color)
+	}
 
 	name := b.String()
 	fl.nameText.SetText(name)
-	fl.sizeText.SetText(" " + files.HumanizeIEC(fl.file.Size))
+	size := " " + files.HumanizeIEC(fl.file.SizeOf(fl.sizeMode))
+	if fl.file.IsDuplicateLink {
+		// size is counted at another link to the same inode
+		if fl.file.IsSymlink || fl.file.IsDir {
+			size += " (counted elsewhere)"
+		} else {
+			size += " (hard link)"
+		}
+	}
+	if fl.file.Excluded != files.NotExcluded {
+		size += " (" + fl.file.Excluded.String() + ", not scanned)"
+	}
+	if fl.file.IsArchive {
+		size += " (archive)"
+	}
+	if fl.file.NumErrors == 1 {
+		size += " (1 error)"
+	} else if fl.file.NumErrors > 1 {
+		size += fmt.Sprintf(" (%d errors)", fl.file.NumErrors)
+	}
+	if fl.wasted > 0 {
+		size += " (" + files.HumanizeIEC(fl.wasted) + " wasted)"
+	}
+	if desc := fl.colors.describe(fl.file); desc != "" {
+		size += " " + desc
+	}
+	fl.sizeText.SetText(size)
 
 	fl.nameText.SetStyle(style)
 	if fl.isSelected {
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/gdamore/tcell/v2/views"
+	"github.com/jensgreen/dux/dux"
+	"github.com/jensgreen/dux/files"
+)
+
+// OwnersPanel lists the users owning the most within the zoom root, with
+// their bytes and number of files, and serves as the legend of the owner
+// colors
+type OwnersPanel struct {
+	owners   []files.OwnerUsage
+	sizeMode files.SizeMode
+	visible  bool
+	lines    []panelLine
+
+	view views.View
+	box  *Box
+
+	views.WidgetWatchers
+}
+
+func (op *OwnersPanel) SetState(state dux.State) {
+	op.owners = state.TopOwners
+	op.sizeMode = state.SizeMode
+	op.visible = state.ColorMode == dux.ColorByOwner && len(state.TopOwners) > 0
+	op.update()
+}
+
+// Visible reports whether there is anything to show
+func (op *OwnersPanel) Visible() bool {
+	return op.visible
+}
+
+// update formats the lines of the panel, aligned in columns
+func (op *OwnersPanel) update() {
+	var names, sizes, counts []string
+	var nameWidth, sizeWidth, countWidth int
+	for _, u := range op.owners {
+		name := ownerName(u.UID)
+		size := files.HumanizeIEC(u.SizeOf(op.sizeMode))
+		count := fmt.Sprintf("%d", u.NumFiles)
+		nameWidth = maxInt(nameWidth, len(name))
+		sizeWidth = maxInt(sizeWidth, len(size))
+		countWidth = maxInt(countWidth, len(count))
+		names, sizes, counts = append(names, name), append(sizes, size), append(counts, count)
+	}
+	op.lines = op.lines[:0]
+	for i, u := range op.owners {
+		op.lines = append(op.lines, panelLine{
+			mark:  '■',
+			color: ownerColor(u.UID, op.owners),
+			text: fmt.Sprintf("%-*s %*s %*s files",
+				nameWidth, names[i], sizeWidth, sizes[i], countWidth, counts[i]),
+		})
+	}
+}
+
+func (op *OwnersPanel) Draw() {
+	if !op.visible || op.view == nil {
+		return
+	}
+	drawPanel(op.view, op.box, "owners", op.lines)
+}
+
+func (op *OwnersPanel) Resize() {
+	op.PostEventWidgetResize(op)
+}
+
+func (op *OwnersPanel) HandleEvent(ev tcell.Event) bool {
+	return false
+}
+
+func (op *OwnersPanel) SetView(view views.View) {
+	op.view = view
+}
+
+// Size returns the size needed to show all owners in a box
+func (op *OwnersPanel) Size() (int, int) {
+	return panelSize("owners", op.lines)
+}
+
+func NewOwnersPanel() *OwnersPanel {
+	return &OwnersPanel{box: NewBox()}
+}
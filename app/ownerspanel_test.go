@@ -0,0 +1,46 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jensgreen/dux/app/testutil"
+	"github.com/jensgreen/dux/dux"
+	"github.com/jensgreen/dux/files"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OwnersPanelDraw(t *testing.T) {
+	// uids without names, to not depend on the users of the system
+	state := dux.State{
+		ColorMode: dux.ColorByOwner,
+		TopOwners: []files.OwnerUsage{
+			{UID: 4000001, DiskSize: 3 * 1024 * 1024, NumFiles: 12},
+			{UID: 4000002, DiskSize: 512, NumFiles: 1},
+		},
+	}
+	op := NewOwnersPanel()
+	op.SetState(state)
+	w, h := op.Size()
+	screen := testutil.InitSimScreen(t, w, h)
+	op.SetView(screen)
+	op.Draw()
+
+	got := testutil.ScreenToString(screen)
+	want := strings.TrimSpace(`
+┌ owners ───────────────┐
+│■ 4000001 3.0M 12 files│
+│■ 4000002 512B  1 files│
+└───────────────────────┘
+`)
+
+	assert.True(t, op.Visible())
+	assert.Equal(t, want, got, "output differs")
+}
+
+func Test_OwnersPanelOnlyVisibleWhenColoringByOwner(t *testing.T) {
+	op := NewOwnersPanel()
+	op.SetState(dux.State{TopOwners: []files.OwnerUsage{{UID: 4000001, NumFiles: 1}}})
+
+	assert.False(t, op.Visible())
+}
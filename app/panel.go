@@ -0,0 +1,61 @@
+package app
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/gdamore/tcell/v2/views"
+)
+
+// panelLine is a line of text in a panel, after a colored mark
+type panelLine struct {
+	mark  rune
+	color tcell.Color
+	text  string
+}
+
+// drawPanel draws lines in a box titled title, clearing the rest of view
+func drawPanel(view views.View, box *Box, title string, lines []panelLine) {
+	w, h := view.Size()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			view.SetContent(x, y, ' ', nil, tcell.StyleDefault)
+		}
+	}
+	box.SetView(view)
+	box.Draw()
+	for x, r := range []rune(" " + title + " ") {
+		if x+1 < w-1 {
+			view.SetContent(x+1, 0, r, nil, tcell.StyleDefault.Bold(true))
+		}
+	}
+	for i, line := range lines {
+		y := i + 1
+		if y >= h-1 {
+			break
+		}
+		view.SetContent(1, y, line.mark, nil, tcell.StyleDefault.Foreground(line.color))
+		for x, r := range []rune(line.text) {
+			if x+3 >= w-1 {
+				break
+			}
+			view.SetContent(x+3, y, r, nil, tcell.StyleDefault)
+		}
+	}
+}
+
+// panelSize returns the size needed by drawPanel to show all lines
+func panelSize(title string, lines []panelLine) (int, int) {
+	width := len([]rune(" " + title + " "))
+	for _, line := range lines {
+		// mark and space
+		width = maxInt(width, len([]rune(line.text))+2)
+	}
+	// borders on both sides
+	return width + 2, len(lines) + 2
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
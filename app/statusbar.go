@@ -1,6 +1,7 @@
 package app
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
@@ -9,8 +10,10 @@ import (
 )
 
 type StatusBar struct {
-	text     *views.Text
-	commands chan<- dux.Command
+	text      *views.Text
+	help      string
+	numErrors int
+	commands  chan<- dux.Command
 
 	views.WidgetWatchers
 }
@@ -42,6 +45,28 @@ func (sb *StatusBar) Size() (int, int) {
 	return sb.text.Size()
 }
 
+// SetErrorCount shows how many errors occurred, in front of the help
+func (sb *StatusBar) SetErrorCount(n int) {
+	if n == sb.numErrors {
+		return
+	}
+	sb.numErrors = n
+	if n == 0 {
+		sb.text.SetText(sb.help)
+		return
+	}
+	noun := "errors"
+	if n == 1 {
+		noun = "error"
+	}
+	prefix := fmt.Sprintf(" %d %s <!> ", n, noun)
+	sb.text.SetText(prefix + "| " + sb.help)
+	style := tcell.StyleDefault.Background(errorColor).Foreground(tcell.ColorWhite).Bold(true)
+	for i := range []rune(prefix) {
+		sb.text.SetStyleAt(i, style)
+	}
+}
+
 func NewStatusBar(commands chan<- dux.Command) *StatusBar {
 	style := tcell.StyleDefault.Background(tcell.ColorBlue).Foreground(tcell.ColorWhite)
 	text := views.NewText()
@@ -53,6 +78,14 @@ func NewStatusBar(commands chan<- dux.Command) *StatusBar {
 		"<enter/bs> up/down",
 		"<io> zoom",
 		"<+-> depth",
+		"<a> apparent size",
+		"<c> colors",
+		"<s> sort",
+		"<t> by type",
+		"<d> duplicates",
+		"<r> rescan",
+		"<e> export",
+		"<!> errors",
 		"<q> quit",
 		// "<?> help",
 	}, " | ")
@@ -61,6 +94,7 @@ func NewStatusBar(commands chan<- dux.Command) *StatusBar {
 
 	return &StatusBar{
 		text:     text,
+		help:     help,
 		commands: commands,
 	}
 }
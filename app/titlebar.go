@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/gdamore/tcell/v2/views"
@@ -38,26 +39,75 @@ func (tb *TitleBar) updateText(state dux.State) {
 }
 
 func (tb *TitleBar) updateLeft(state dux.State, f files.File) {
+	path := f.Path
+	if f.IsTotal() {
+		path = "total"
+	}
 	left := " " + fmt.Sprintf(
 		"%s %s (%d files)",
-		f.Path,
-		files.HumanizeIEC(f.Size),
+		path,
+		files.HumanizeIEC(f.SizeOf(state.SizeMode)),
 		state.TotalFiles,
 	)
+	if f.NumExcluded > 0 {
+		left += fmt.Sprintf(" (%d excluded)", f.NumExcluded)
+	}
 	if state.Pause {
 		left += " PAUSED"
 	} else if state.IsWalkingFiles {
 		left += " " + tb.spinner.String()
+		if state.Progress.Elapsed > 0 {
+			left += " " + describeProgress(state.Progress)
+		}
+	} else if state.IsRescanning {
+		left += " " + tb.spinner.String() + " rescanning"
+	} else if state.IsHashing {
+		left += " " + tb.spinner.String() + " finding duplicates"
+	} else if state.IsWatching {
+		left += " watching"
+	}
+	if state.Notice != "" {
+		left += " | " + state.Notice
 	}
 	tb.textBar.SetLeft(left, tb.style)
 }
 
+// describeProgress returns how far walking has come, and how fast
+func describeProgress(s files.ProgressStats) string {
+	desc := fmt.Sprintf("%d dirs, %.0f files/s, %s/s, %s",
+		s.Dirs,
+		s.FilesPerSec(),
+		files.HumanizeIEC(int64(s.BytesPerSec())),
+		s.Elapsed.Round(time.Second),
+	)
+	if percent, ok := s.Percent(); ok {
+		desc += fmt.Sprintf(", ~%d%%", percent)
+	}
+	if s.CurrentDir != "" {
+		desc += " | " + s.CurrentDir
+	}
+	return desc
+}
+
 func (tb *TitleBar) updateRight(state dux.State) {
-	var right string
+	right := ""
+	if !state.SnapshotTime.IsZero() {
+		right += "snapshot of " + state.SnapshotTime.Format("2006-01-02 15:04") + " | "
+	}
+	if state.TypeView {
+		right += "by type | "
+	}
+	right += state.SizeMode.String() + " | "
+	if state.SortKey != files.SortBySize {
+		right += "sorted by " + state.SortKey.String() + " | "
+	}
+	if state.ColorMode != dux.ColorByType {
+		right += "colors: " + state.ColorMode.String() + " | "
+	}
 	if state.MaxDepth > 0 {
-		right = fmt.Sprintf("depth: %d ", state.MaxDepth)
+		right += fmt.Sprintf("depth: %d ", state.MaxDepth)
 	} else {
-		right = "depth: ∞ "
+		right += "depth: ∞ "
 	}
 	tb.textBar.SetRight(right, tb.style)
 }
@@ -12,6 +12,7 @@ type TreemapWidget struct {
 	width    int
 	height   int
 	appState dux.State
+	colors   colorScheme
 	treemap  treemap.Z2Treemap
 	commands chan<- dux.Command
 
@@ -31,10 +32,14 @@ func (tv *TreemapWidget) updateWidgets(isRoot bool) {
 	treemap := tv.treemap
 
 	tv.label.SetFile(treemap.File)
+	tv.label.SetSizeMode(tv.appState.SizeMode)
+	tv.label.SetColorScheme(tv.colors)
+	tv.label.SetWasted(tv.appState.Duplicates.Wasted(treemap.Path()))
 	tv.label.SetIsRoot(isRoot)
 	tv.label.Select(tv.isSelected())
 	tv.setLabelView(tv.view)
 	tv.box.Select(tv.isSelected())
+	tv.box.SetColor(tv.colors.tileColor(treemap.File))
 	tv.setBoxView(tv.view)
 
 	widgets := make([]*TreemapWidget, len(treemap.Children))
@@ -43,14 +48,19 @@ func (tv *TreemapWidget) updateWidgets(isRoot bool) {
 			width:    child.Rect.X.Hi - child.Rect.X.Lo,
 			height:   child.Rect.Y.Hi - child.Rect.Y.Lo,
 			appState: tv.appState,
+			colors:   tv.colors,
 			commands: tv.commands,
 			treemap:  *child,
 			box:      NewBox(),
 			label:    NewFileLabel(),
 		}
 		w.label.SetFile(w.treemap.File)
+		w.label.SetSizeMode(w.appState.SizeMode)
+		w.label.SetColorScheme(w.colors)
+		w.label.SetWasted(w.appState.Duplicates.Wasted(w.treemap.Path()))
 		w.label.Select(w.isSelected())
 		w.box.Select(w.isSelected())
+		w.box.SetColor(w.colors.tileColor(w.treemap.File))
 		w.SetView(tv.view)
 		widgets[i] = w
 	}
@@ -63,6 +73,7 @@ func (tv *TreemapWidget) updateWidgets(isRoot bool) {
 func (tv *TreemapWidget) Draw() {
 	isRoot := true
 	tv.view.Clear()
+	tv.colors = newColorScheme(tv.appState)
 	tv.treemap = *treemap.NewZ2Treemap(tv.appState.Treemap)
 	tv.updateWidgets(isRoot)
 	tv.draw(isRoot)
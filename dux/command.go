@@ -3,6 +3,7 @@ package dux
 import (
 	"log"
 
+	"github.com/jensgreen/dux/files"
 	"github.com/jensgreen/dux/geo/z2"
 	"github.com/jensgreen/dux/nav"
 )
@@ -133,3 +134,109 @@ func (cmd ZoomOut) Execute(state State) (State, Action) {
 	}
 	return state, ActionNone
 }
+
+type ToggleSizeMode struct{}
+
+func (cmd ToggleSizeMode) Execute(state State) (State, Action) {
+	if state.SizeMode == files.ApparentSize {
+		state.SizeMode = files.DiskUsage
+	} else {
+		state.SizeMode = files.ApparentSize
+	}
+	return state, ActionNone
+}
+
+// CycleColorMode switches to the next ColorMode
+type CycleColorMode struct{}
+
+func (cmd CycleColorMode) Execute(state State) (State, Action) {
+	state.ColorMode = (state.ColorMode + 1) % numColorModes
+	return state, ActionNone
+}
+
+// CycleSortKey switches to the next files.SortKey, which orders the tiles
+// within each directory
+type CycleSortKey struct{}
+
+func (cmd CycleSortKey) Execute(state State) (State, Action) {
+	state.SortKey = (state.SortKey + 1) % files.NumSortKeys
+	return state, ActionNone
+}
+
+// ToggleTypeView switches between showing files by directory and by type,
+// keeping the zoom root
+type ToggleTypeView struct{}
+
+func (cmd ToggleTypeView) Execute(state State) (State, Action) {
+	if state.Treemap == nil {
+		return state, ActionNone
+	}
+	if state.TypeView {
+		state.TypeView = false
+		state.Zoom = state.DirZoom
+		state.DirZoom = nil
+	} else {
+		state.TypeView = true
+		state.TypeRoot = state.Treemap.Path()
+		state.DirZoom = state.Zoom
+		state.Zoom = nil
+	}
+	state.Selection = nil
+	return state, ActionNone
+}
+
+// ToggleDuplicates starts or stops finding files with the same contents, once
+// the walk is done
+type ToggleDuplicates struct{}
+
+func (cmd ToggleDuplicates) Execute(state State) (State, Action) {
+	if state.IsImported {
+		state.Notice = "cannot find duplicates of imported files"
+		return state, ActionNone
+	}
+	state.FindDuplicates = !state.FindDuplicates
+	if !state.FindDuplicates {
+		state.IsHashing = false
+		state.Duplicates = nil
+	}
+	return state, ActionNone
+}
+
+// Rescan walks the selection, or the zoom root, anew in the background. Only
+// one rescan runs at a time, and not before the first walk is done.
+type Rescan struct{}
+
+func (cmd Rescan) Execute(state State) (State, Action) {
+	if state.IsImported || state.IsWalkingFiles || state.IsRescanning || state.Treemap == nil {
+		return state, ActionNone
+	}
+	target := state.Treemap.Path()
+	if state.TypeView {
+		// paths in the type view are not those of files
+		target = state.TypeRoot
+	} else if state.Selection != nil {
+		target = state.Selection.Path()
+	}
+	state.IsRescanning = true
+	state.RescanPath = target
+	return state, ActionNone
+}
+
+// ExportNcdu exports the zoom root, or the whole tree, to File in the ncdu JSON
+// export format, once the walk is done
+type ExportNcdu struct {
+	File  string
+	Whole bool
+}
+
+func (cmd ExportNcdu) Execute(state State) (State, Action) {
+	export := &Export{File: cmd.File, Whole: cmd.Whole || state.Zoom == nil}
+	if state.TypeView {
+		export.Whole = cmd.Whole
+		export.Root = state.TypeRoot
+	} else if !export.Whole {
+		export.Root = state.Zoom.Path()
+	}
+	state.PendingExport = export
+	return state, ActionNone
+}
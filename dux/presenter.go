@@ -2,7 +2,13 @@ package dux
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/jensgreen/dux/cancellable"
 	"github.com/jensgreen/dux/files"
@@ -16,32 +22,70 @@ type Presenter struct {
 	ctx         context.Context
 	shutdown    context.CancelFunc
 	fileEvents  <-chan files.FileEvent
+	watchEvents <-chan files.FileEvent
 	commands    <-chan Command
 	stateEvents chan<- StateEvent
 	tiler       tiling.Tiler
 	state       State
 	fs          *files.FS
+	walkOpts    files.WalkOptions
+	rescans     chan rescanResult
+	byType      byTypeView
+	dupes       duplicateSearch
+	// replaced are the paths replaced since the last StateEvent
+	replaced []string
+}
+
+// duplicateSearch is a search for duplicate files in the background
+type duplicateSearch struct {
+	sets      <-chan files.DuplicateSet
+	stop      context.CancelFunc
+	found     []files.DuplicateSet
+	published time.Time
+}
+
+// byTypeView is the tree grouped by type, as of a version of the FS
+type byTypeView struct {
+	root    string
+	version uint64
+	built   time.Time
+	fs      *files.FS
+}
+
+// rescanResult is the outcome of walking a part of the tree anew
+type rescanResult struct {
+	path string
+	// tree is nil if path no longer exists
+	tree *files.FileTree
+	errs []error
+	// inodes are those counted by the rescan
+	inodes *files.Inodes
 }
 
 func NewPresenter(
 	ctx context.Context,
 	shutdown context.CancelFunc,
 	fileEvents <-chan files.FileEvent,
+	watchEvents <-chan files.FileEvent,
 	commands <-chan Command,
 	stateEvents chan<- StateEvent,
 	initialState State,
 	tiler tiling.Tiler,
 	fs *files.FS,
+	walkOpts files.WalkOptions,
 ) Presenter {
 	return Presenter{
 		ctx:         ctx,
 		shutdown:    shutdown,
 		fileEvents:  fileEvents,
+		watchEvents: watchEvents,
 		commands:    commands,
 		stateEvents: stateEvents,
 		state:       initialState,
 		tiler:       tiler,
 		fs:          fs,
+		walkOpts:    walkOpts,
+		rescans:     make(chan rescanResult, 1),
 	}
 }
 
@@ -62,6 +106,12 @@ func (p *Presenter) pollEvent() (Action, []error) {
 		}
 		p.state, action = p.processCommand(cmd)
 	} else {
+		// changes are only applied on top of a completed walk
+		watchEvents := p.watchEvents
+		if p.fileEvents != nil {
+			watchEvents = nil
+		}
+
 		select {
 		case <-p.ctx.Done():
 			p.state.Quit = true
@@ -78,17 +128,244 @@ func (p *Presenter) pollEvent() (Action, []error) {
 				break
 			}
 			if event.Error != nil {
+				p.attachError(event.Error)
+				errs = append(errs, event.Error)
+				break
+			}
+			p.applyFileEvent(event)
+		case event, ok := <-watchEvents:
+			log.Printf("Presenter got watch FileEvent")
+			if !ok {
+				p.watchEvents = nil
+				p.state.IsWatching = false
+				break
+			}
+			if event.Error != nil {
+				p.attachError(event.Error)
 				errs = append(errs, event.Error)
 				break
 			}
-			f := event.File
-			log.Printf("Got FileEvent for %v with size %v", f.Path, f.Size)
-			p.fs.Insert(f)
+			p.applyFileEvent(event)
+		case set, ok := <-p.dupes.sets:
+			if !ok {
+				p.dupes.sets = nil
+				p.state.IsHashing = false
+				p.publishDuplicates()
+				break
+			}
+			p.dupes.found = append(p.dupes.found, set)
+			if time.Since(p.dupes.published) >= duplicatesInterval {
+				p.publishDuplicates()
+			}
+		case result := <-p.rescans:
+			log.Printf("Presenter got rescan of %v", result.path)
+			p.applyRescan(result)
+			p.state.IsRescanning = false
+			for _, err := range result.errs {
+				p.attachError(err)
+			}
+			errs = append(errs, result.errs...)
 		}
 	}
 	return action, errs
 }
 
+// attachError attaches err to the file it is about, if any
+func (p *Presenter) attachError(err error) {
+	var perr *fs.PathError
+	if errors.As(err, &perr) {
+		p.fs.AddError(perr.Path, err)
+	}
+}
+
+// export writes an ncdu export of the tree requested
+func (p *Presenter) export(export Export) error {
+	root, ok := p.fs.Root()
+	if !export.Whole {
+		root, ok = p.fs.Find(export.Root)
+	}
+	if !ok {
+		return fmt.Errorf("cannot export '%s': nothing to export", export.File)
+	}
+
+	f, err := os.Create(export.File)
+	if err != nil {
+		return err
+	}
+	err = files.ExportNcdu(f, root)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot export '%s': %w", export.File, err)
+	}
+	p.state.Notice = "exported to " + export.File
+	return nil
+}
+
+func (p *Presenter) applyRescan(result rescanResult) {
+	event := files.FileEvent{Kind: files.FileReplaced, File: files.File{Path: result.path}, Tree: result.tree}
+	if result.tree == nil {
+		event.Kind = files.FileRemoved
+	}
+	p.applyFileEvent(event)
+	p.walkOpts.Inodes.Replace(result.path, result.inodes)
+}
+
+// startRescan walks path anew in the background, and sends the result to
+// p.rescans
+func (p *Presenter) startRescan(path string) {
+	// members of archives are rescanned by reading the archive again
+	for node, ok := p.fs.Find(path); ok; node, ok = node.Parent() {
+		if node.File().IsArchive {
+			path = node.File().Path
+		}
+	}
+	opts := p.walkOpts
+	// only the progress of the first walk is shown
+	opts.Progress = nil
+	// hard links to inodes counted elsewhere are not counted again
+	opts.Inodes = p.walkOpts.Inodes.Outside(path)
+	paths := []string{path}
+	fs := files.NewFSWithOptions(p.fs.SubtreeOptions(path))
+	if node, ok := p.fs.Find(path); ok && node.File().Path == files.TotalPath {
+		// the total is rescanned by walking each of its paths
+		paths = nil
+		for _, c := range node.Children() {
+			paths = append(paths, c.File().Path)
+		}
+		_ = fs.Insert(node.File())
+	} else if ok {
+		// exclude patterns are relative to the path originally walked
+		for parent, ok := node.Parent(); ok && parent.File().Path != files.TotalPath; parent, ok = parent.Parent() {
+			opts.Base = parent.File().Path
+		}
+	}
+
+	go func() {
+		events := make(chan files.FileEvent)
+		go files.WalkPaths(p.ctx, paths, events, opts)
+
+		var errs []error
+		for event := range events {
+			if event.Error != nil {
+				errs = append(errs, event.Error)
+				continue
+			}
+			if err := fs.Insert(event.File); err != nil {
+				log.Printf("Could not insert rescanned %v: %v", event.File.Path, err)
+			}
+		}
+		tree, _ := fs.Root()
+		_ = cancellable.Send(p.ctx, p.rescans, rescanResult{path: path, tree: tree, errs: errs, inodes: opts.Inodes})
+	}()
+}
+
+func (p *Presenter) applyFileEvent(event files.FileEvent) {
+	f := event.File
+	log.Printf("Got FileEvent %d for %v with size %v", event.Kind, f.Path, f.Size)
+	var err error
+	switch event.Kind {
+	case files.FileCreated:
+		err = p.fs.Insert(f)
+	case files.FileRemoved:
+		err = p.fs.Remove(f.Path)
+		p.replaced = append(p.replaced, f.Path)
+	case files.FileUpdated:
+		err = p.fs.Update(f)
+	case files.FileReplaced:
+		err = p.fs.ReplaceSubtree(f.Path, event.Tree)
+		p.replaced = append(p.replaced, f.Path)
+	}
+	if err != nil {
+		log.Printf("Could not apply FileEvent for %v: %v", f.Path, err)
+	}
+}
+
+// findClosest returns the node at path, or its closest ancestor still in the
+// tree
+func findClosest(fs *files.FS, path string) (*files.FileTree, bool) {
+	for {
+		if node, ok := fs.Find(path); ok {
+			return node, true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return nil, false
+		}
+		path = parent
+	}
+}
+
+// byTypeInterval is how often the tree grouped by type is rebuilt while
+// walking, as rebuilding takes time in proportion to the number of files
+const byTypeInterval = time.Second
+
+// byTypeFS returns the files below the type root grouped by type. It is
+// rebuilt when the tree has changed, but not more often than byTypeInterval
+// while walking.
+func (p *Presenter) byTypeFS() (*files.FS, bool) {
+	base, ok := findClosest(p.fs, p.state.TypeRoot)
+	if !ok {
+		return nil, false
+	}
+	bt := &p.byType
+	moved := bt.fs == nil || bt.root != base.File().Path
+	changed := bt.version != p.fs.Version()
+	due := !p.state.IsWalkingFiles || time.Since(bt.built) >= byTypeInterval
+	if moved || (changed && due) {
+		bt.fs = files.GroupByType(base)
+		bt.root = base.File().Path
+		bt.version = p.fs.Version()
+		bt.built = time.Now()
+	}
+	bt.fs.SetOrder(p.fs.Order())
+	return bt.fs, true
+}
+
+// duplicatesInterval is how often the duplicates found so far are shown, as
+// indexing them takes time in proportion to the number found
+const duplicatesInterval = time.Second
+
+// startDuplicates starts hashing the files that may be duplicates
+func (p *Presenter) startDuplicates() {
+	root, ok := p.fs.Root()
+	if !ok {
+		return
+	}
+	ctx, stop := context.WithCancel(p.ctx)
+	sets := make(chan files.DuplicateSet)
+	p.dupes = duplicateSearch{sets: sets, stop: stop, published: time.Now()}
+	p.state.IsHashing = true
+	p.state.Duplicates = files.NewDuplicates(nil)
+	go files.HashDuplicates(ctx, files.DuplicateCandidates(root), p.walkOpts.Jobs, p.walkOpts.Throttle, sets)
+}
+
+func (p *Presenter) stopDuplicates() {
+	if p.dupes.stop != nil {
+		p.dupes.stop()
+	}
+	p.dupes = duplicateSearch{}
+}
+
+// publishDuplicates shows the duplicates found so far
+func (p *Presenter) publishDuplicates() {
+	p.state.Duplicates = files.NewDuplicates(p.dupes.found)
+	p.dupes.published = time.Now()
+}
+
+// maxTopOwners is how many owners are shown, and colored, separately
+const maxTopOwners = 8
+
+// topOwners returns the users owning the most within tree
+func topOwners(tree *files.FileTree) []files.OwnerUsage {
+	owners := tree.Owners()
+	if len(owners) > maxTopOwners {
+		owners = owners[:maxTopOwners]
+	}
+	return owners
+}
+
 func (p *Presenter) tick() {
 	defer func() {
 		if p.state.Quit {
@@ -101,20 +378,43 @@ func (p *Presenter) tick() {
 	}()
 
 	action, errs := p.pollEvent()
-	root, ok := p.fs.Root()
+	p.fs.SetOrder(files.Order{Key: p.state.SortKey, SizeMode: p.state.SizeMode})
+	if p.state.IsWalkingFiles {
+		p.state.Progress = p.walkOpts.Progress.Stats()
+	}
+	if p.state.PendingExport != nil && !p.state.IsWalkingFiles {
+		if err := p.export(*p.state.PendingExport); err != nil {
+			errs = append(errs, err)
+		}
+		p.state.PendingExport = nil
+	}
+	if p.state.FindDuplicates && !p.state.IsWalkingFiles && p.state.Duplicates == nil && p.dupes.sets == nil {
+		p.startDuplicates()
+	}
+	// the tree shown, as is or grouped by type
+	view := p.fs
+	if p.state.TypeView {
+		if byType, ok := p.byTypeFS(); ok {
+			view = byType
+		}
+	}
+	root, ok := view.Root()
 	if ok {
 		rootRect := r2.RectFromPoints(r2.Point{X: 0, Y: 0}, z2.PointAsR2(p.state.TreemapSize))
 
 		var rootTreemap *treemap.R2Treemap
 		var rootFileTree = *root
 		if p.state.Zoom != nil {
-			node, ok := p.fs.Find(p.state.Zoom.Path())
-			if !ok {
-				panic("zoom target removed from tree")
+			node, ok := findClosest(view, p.state.Zoom.Path())
+			if ok {
+				rootFileTree = *node
 			}
-			rootFileTree = *node
 		}
-		rootTreemap = treemap.NewR2Treemap(rootFileTree, rootRect, p.tiler, p.state.MaxDepth)
+		rootTreemap = treemap.NewR2Treemap(rootFileTree, rootRect, p.tiler, p.state.MaxDepth, p.state.SizeMode)
+		p.state.TopOwners = nil
+		if p.state.ColorMode == ColorByOwner {
+			p.state.TopOwners = topOwners(&rootFileTree)
+		}
 
 		if p.state.Selection != nil {
 			selection, err := rootTreemap.FindNode(p.state.Selection.Path())
@@ -124,7 +424,7 @@ func (p *Presenter) tick() {
 				p.state.Selection = nil
 				p.state.TotalFiles = 1 + root.File().NumDescendants
 			} else {
-				node, ok := p.fs.Find(p.state.Selection.Path())
+				node, ok := view.Find(p.state.Selection.Path())
 				if !ok {
 					panic("selection removed from tree")
 				}
@@ -136,7 +436,7 @@ func (p *Presenter) tick() {
 		}
 
 		if p.state.Zoom != nil {
-			zoom, err := rootTreemap.FindNode(p.state.Zoom.Path())
+			zoom, err := rootTreemap.FindNode(rootFileTree.File().Path)
 			if err != nil {
 				// selected zoom node has been removed from the new treemap
 				// TODO select closest (grand)parent still remaining
@@ -152,7 +452,8 @@ func (p *Presenter) tick() {
 	}
 
 	log.Printf("Sending stateEvent")
-	err := cancellable.Send(p.ctx, p.stateEvents, StateEvent{State: p.state, Action: action, Errors: errs})
+	err := cancellable.Send(p.ctx, p.stateEvents, StateEvent{State: p.state, Action: action, Replaced: p.replaced, Errors: errs})
+	p.replaced = nil
 	if err != nil {
 		p.state.Quit = true
 		return
@@ -162,5 +463,17 @@ func (p *Presenter) tick() {
 
 func (p *Presenter) processCommand(cmd Command) (State, Action) {
 	log.Printf("Executing command %T", cmd)
-	return cmd.Execute(p.state)
+	p.state.Notice = ""
+	state, action := cmd.Execute(p.state)
+	if state.IsRescanning && !p.state.IsRescanning {
+		p.startRescan(state.RescanPath)
+	}
+	if !state.FindDuplicates && p.state.FindDuplicates {
+		p.stopDuplicates()
+	}
+	if state.Pause != p.state.Pause {
+		// stop walking too, rather than only stop taking in what is walked
+		p.walkOpts.Throttle.SetPaused(state.Pause)
+	}
+	return state, action
 }
@@ -3,10 +3,13 @@ package dux
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/jensgreen/dux/files"
 	"github.com/jensgreen/dux/geo/r2"
+	"github.com/jensgreen/dux/geo/z2"
 	"github.com/jensgreen/dux/treemap/tiling"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,7 +17,7 @@ import (
 
 type mockTiler struct{}
 
-func (t mockTiler) Tile(rect r2.Rect, fileTree files.FileTree, depth int) (tiles []tiling.Tile, spillage r2.Rect) {
+func (t mockTiler) Tile(rect r2.Rect, fileTree files.FileTree, depth int, mode files.SizeMode) (tiles []tiling.Tile, spillage r2.Rect) {
 	return make([]tiling.Tile, len(fileTree.Children())), r2.Rect{}
 }
 
@@ -26,7 +29,7 @@ func Test_TickProducesStateEvents(t *testing.T) {
 	fileEvents <- files.FileEvent{File: files.File{Path: "foo"}}
 	close(fileEvents)
 
-	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, stateEvents, State{}, nil, files.NewFS())
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, nil, stateEvents, State{}, nil, files.NewFS(), files.WalkOptions{})
 	pres.tick()
 
 	stateEvent, ok := <-stateEvents
@@ -43,7 +46,7 @@ func Test_WalkDirConcurrencyIntegration(t *testing.T) {
 	}()
 
 	stateEvents := make(chan StateEvent)
-	pres := NewPresenter(context.Background(), cancel, fileEvents, commands, stateEvents, State{}, mockTiler{}, files.NewFS())
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, commands, stateEvents, State{}, mockTiler{}, files.NewFS(), files.WalkOptions{})
 	go pres.Loop()
 
 	for e := range stateEvents {
@@ -66,7 +69,7 @@ func Test_EmitsStateEventForRootOnEachFileEvent(t *testing.T) {
 	fileEvents <- files.FileEvent{File: child}
 	close(fileEvents)
 
-	pres := NewPresenter(context.Background(), cancel, fileEvents, commands, stateEvents, State{}, mockTiler{}, files.NewFS())
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, commands, stateEvents, State{}, mockTiler{}, files.NewFS(), files.WalkOptions{})
 	pres.tick() // foo
 	pres.tick() // foo/bar
 	pres.tick() // closed
@@ -85,7 +88,7 @@ func Test_EmitsStateEventOnFileEvent(t *testing.T) {
 
 	fileEvents <- files.FileEvent{File: files.File{Path: "foo"}}
 
-	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, stateEvents, State{}, mockTiler{}, files.NewFS())
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, nil, stateEvents, State{}, mockTiler{}, files.NewFS(), files.WalkOptions{})
 	pres.tick()
 	_, ok := <-stateEvents
 	assert.True(t, ok, "no StateEvent sent")
@@ -94,7 +97,7 @@ func Test_EmitsStateEventOnFileEvent(t *testing.T) {
 func Test_QuitCommandUpdatesQuitState(t *testing.T) {
 	stateEvents := make(chan StateEvent, 1)
 	commands := make(chan Command, 1)
-	pres := NewPresenter(context.Background(), cancel, nil, commands, stateEvents, State{}, mockTiler{}, files.NewFS())
+	pres := NewPresenter(context.Background(), cancel, nil, nil, commands, stateEvents, State{}, mockTiler{}, files.NewFS(), files.WalkOptions{})
 	commands <- Quit{}
 	pres.tick()
 
@@ -102,3 +105,274 @@ func Test_QuitCommandUpdatesQuitState(t *testing.T) {
 	require.True(t, ok)
 	assert.True(t, update.State.Quit, "quit flag not set")
 }
+
+func Test_AppliesWatchEventsAfterWalk(t *testing.T) {
+	fileEvents := make(chan files.FileEvent, 2)
+	watchEvents := make(chan files.FileEvent, 1)
+	stateEvents := make(chan StateEvent, 4)
+
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo", IsDir: true}}
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo/bar", Size: 1}}
+	watchEvents <- files.FileEvent{Kind: files.FileRemoved, File: files.File{Path: "foo/bar"}}
+	close(fileEvents)
+
+	fs := files.NewFS()
+	pres := NewPresenter(context.Background(), cancel, fileEvents, watchEvents, nil, stateEvents, State{}, mockTiler{}, fs, files.WalkOptions{})
+	pres.tick() // foo
+	pres.tick() // foo/bar
+	_, ok := fs.Find("foo/bar")
+	require.True(t, ok, "watch event applied before walk was done")
+	pres.tick() // closed
+	pres.tick() // removed foo/bar
+
+	_, ok = fs.Find("foo/bar")
+	assert.False(t, ok)
+	root, _ := fs.Root()
+	assert.Equal(t, int64(0), root.File().Size)
+}
+
+func Test_RescanReplacesSelectedSubtree(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	require.NoError(t, os.Mkdir(sub, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(sub, "old"), []byte("old"), 0o644))
+
+	fileEvents := make(chan files.FileEvent)
+	go files.WalkDir(context.Background(), root, fileEvents, os.ReadDir)
+	stateEvents := make(chan StateEvent, 8)
+	commands := make(chan Command, 1)
+	fs := files.NewFS()
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, commands, stateEvents, State{TreemapSize: z2.Point{X: 80, Y: 24}}, tiling.SliceAndDice{}, fs, files.WalkOptions{})
+	for pres.fileEvents != nil {
+		pres.tick()
+		<-stateEvents
+	}
+
+	require.NoError(t, os.Remove(filepath.Join(sub, "old")))
+	require.NoError(t, os.WriteFile(filepath.Join(sub, "new"), []byte("newer"), 0o644))
+	commands <- Select{Path: sub}
+	pres.tick()
+	<-stateEvents
+	commands <- Rescan{}
+	pres.tick()
+	event := <-stateEvents
+	assert.True(t, event.State.IsRescanning)
+	pres.tick() // rescan done
+	event = <-stateEvents
+
+	assert.False(t, event.State.IsRescanning)
+	assert.Equal(t, []string{sub}, event.Replaced, "expected errors below sub to be pruned")
+	require.NotNil(t, event.State.Selection)
+	assert.Equal(t, sub, event.State.Selection.Path(), "expected selection to be kept")
+	_, ok := fs.Find(filepath.Join(sub, "old"))
+	assert.False(t, ok)
+	_, ok = fs.Find(filepath.Join(sub, "new"))
+	assert.True(t, ok)
+	rootNode, _ := fs.Root()
+	assert.Equal(t, int64(5), rootNode.File().Size)
+}
+
+func Test_RescanCountsHardLinksOnce(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		require.NoError(t, os.Mkdir(filepath.Join(root, dir), 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a", "file"), []byte("hello"), 0o644))
+	require.NoError(t, os.Link(filepath.Join(root, "a", "file"), filepath.Join(root, "b", "link")))
+
+	opts := files.WalkOptions{Inodes: files.NewInodes()}
+	fileEvents := make(chan files.FileEvent)
+	go files.Walk(context.Background(), root, fileEvents, opts)
+	stateEvents := make(chan StateEvent, 8)
+	commands := make(chan Command, 1)
+	fs := files.NewFS()
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, commands, stateEvents, State{TreemapSize: z2.Point{X: 80, Y: 24}}, tiling.SliceAndDice{}, fs, opts)
+	for pres.fileEvents != nil {
+		pres.tick()
+		<-stateEvents
+	}
+	size := func() int64 {
+		rootNode, _ := fs.Root()
+		return rootNode.File().Size
+	}
+	require.Equal(t, int64(5), size())
+
+	for _, dir := range []string{"a", "b", "b", "a"} {
+		commands <- Select{Path: filepath.Join(root, dir)}
+		pres.tick()
+		<-stateEvents
+		commands <- Rescan{}
+		pres.tick()
+		<-stateEvents
+		pres.tick() // rescan done
+		<-stateEvents
+
+		assert.Equal(t, int64(5), size(), "after rescanning %s", dir)
+	}
+}
+
+func Test_ExportWaitsForWalk(t *testing.T) {
+	fileEvents := make(chan files.FileEvent, 2)
+	stateEvents := make(chan StateEvent, 4)
+	commands := make(chan Command, 1)
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo", IsDir: true}}
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo/bar", Size: 1}}
+	close(fileEvents)
+	export := filepath.Join(t.TempDir(), "export.json")
+
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, commands, stateEvents, State{IsWalkingFiles: true}, mockTiler{}, files.NewFS(), files.WalkOptions{})
+	commands <- ExportNcdu{File: export, Whole: true}
+	pres.tick() // command
+	pres.tick() // foo
+	pres.tick() // foo/bar
+	_, err := os.Stat(export)
+	require.ErrorIs(t, err, os.ErrNotExist, "exported before walk was done")
+	pres.tick() // closed
+
+	data, err := os.ReadFile(export)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `{"name":"bar","asize":1}`)
+	var last StateEvent
+	for i := 0; i < 4; i++ {
+		last = <-stateEvents
+	}
+	assert.Equal(t, "exported to "+export, last.State.Notice)
+}
+
+func Test_TogglePausePausesWalker(t *testing.T) {
+	stateEvents := make(chan StateEvent, 2)
+	commands := make(chan Command, 1)
+	throttle := files.NewThrottle(0)
+	pres := NewPresenter(context.Background(), cancel, nil, nil, commands, stateEvents, State{}, mockTiler{}, files.NewFS(), files.WalkOptions{Throttle: throttle})
+
+	commands <- TogglePause{}
+	pres.tick()
+
+	ctx, cancelWait := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelWait()
+	assert.ErrorIs(t, throttle.Wait(ctx), context.DeadlineExceeded, "expected walker to be paused")
+
+	commands <- TogglePause{}
+	pres.tick()
+	assert.NoError(t, throttle.Wait(context.Background()))
+}
+
+func Test_TopOwnersWhenColoringByOwner(t *testing.T) {
+	fileEvents := make(chan files.FileEvent, 3)
+	stateEvents := make(chan StateEvent, 3)
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo", IsDir: true, UID: 1000, HasOwner: true}}
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo/a", DiskSize: 1, UID: 1000, HasOwner: true}}
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo/b", DiskSize: 5, UID: 1001, HasOwner: true}}
+	close(fileEvents)
+
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, nil, stateEvents, State{ColorMode: ColorByOwner}, mockTiler{}, files.NewFS(), files.WalkOptions{})
+	pres.tick()
+	pres.tick()
+	pres.tick()
+
+	var last StateEvent
+	for i := 0; i < 3; i++ {
+		last = <-stateEvents
+	}
+	assert.Equal(t, []files.OwnerUsage{
+		{UID: 1001, DiskSize: 5, NumFiles: 1},
+		{UID: 1000, DiskSize: 1, NumFiles: 2},
+	}, last.State.TopOwners)
+}
+
+func Test_TypeViewKeepsZoomRoot(t *testing.T) {
+	fileEvents := make(chan files.FileEvent, 5)
+	stateEvents := make(chan StateEvent, 1)
+	commands := make(chan Command, 1)
+	for _, f := range []files.File{
+		{Path: "foo", IsDir: true},
+		{Path: "foo/sub", IsDir: true},
+		{Path: "foo/sub/a.mp4", Size: 30},
+		{Path: "foo/sub/b.go", Size: 10},
+		{Path: "foo/c.go", Size: 500},
+	} {
+		fileEvents <- files.FileEvent{File: f}
+	}
+	close(fileEvents)
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, commands, stateEvents, State{TreemapSize: z2.Point{X: 80, Y: 24}}, tiling.SliceAndDice{}, files.NewFS(), files.WalkOptions{})
+	for i := 0; i < 6; i++ {
+		pres.tick()
+		<-stateEvents
+	}
+	commands <- Select{Path: "foo/sub"}
+	pres.tick()
+	<-stateEvents
+	commands <- ZoomIn{}
+	pres.tick()
+	<-stateEvents
+
+	commands <- ToggleTypeView{}
+	pres.tick()
+	event := <-stateEvents
+	assert.Equal(t, "foo/sub", event.State.Treemap.Path())
+	assert.Equal(t, int64(40), event.State.Treemap.File.Size)
+	media, err := event.State.Treemap.FindNode("foo/sub/media")
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), media.File.Size)
+
+	commands <- ToggleTypeView{}
+	pres.tick()
+	event = <-stateEvents
+	assert.False(t, event.State.TypeView)
+	assert.Equal(t, "foo/sub", event.State.Treemap.Path())
+	_, err = event.State.Treemap.FindNode("foo/sub/b.go")
+	assert.NoError(t, err)
+}
+
+func Test_FindsDuplicatesAfterWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte("same"), 0o644))
+	}
+	fileEvents := make(chan files.FileEvent)
+	go files.WalkDir(context.Background(), root, fileEvents, os.ReadDir)
+	stateEvents := make(chan StateEvent, 1)
+	commands := make(chan Command, 1)
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, commands, stateEvents, State{IsWalkingFiles: true}, mockTiler{}, files.NewFS(), files.WalkOptions{Jobs: 2})
+	commands <- ToggleDuplicates{}
+	pres.tick()
+	event := <-stateEvents
+	assert.True(t, event.State.FindDuplicates)
+	assert.False(t, event.State.IsHashing, "expected to wait for the walk")
+
+	for event.State.IsWalkingFiles || event.State.IsHashing {
+		pres.tick()
+		event = <-stateEvents
+	}
+
+	require.NotNil(t, event.State.Duplicates)
+	assert.Equal(t, int64(4), event.State.Duplicates.TotalWasted())
+	assert.Equal(t, int64(4), event.State.Duplicates.Wasted(root))
+}
+
+func Test_CycleSortKeyResortsTiles(t *testing.T) {
+	fileEvents := make(chan files.FileEvent, 3)
+	stateEvents := make(chan StateEvent, 4)
+	commands := make(chan Command, 1)
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo", IsDir: true}}
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo/a", DiskSize: 1}}
+	fileEvents <- files.FileEvent{File: files.File{Path: "foo/b", DiskSize: 5}}
+
+	pres := NewPresenter(context.Background(), cancel, fileEvents, nil, commands, stateEvents, State{}, mockTiler{}, files.NewFS(), files.WalkOptions{})
+	pres.tick()
+	pres.tick()
+	pres.tick()
+	for i := 0; i < 3; i++ {
+		<-stateEvents
+	}
+	root, ok := pres.fs.Root()
+	require.True(t, ok)
+	assert.Equal(t, "foo/b", root.Children()[0].Path())
+
+	commands <- CycleSortKey{}
+	pres.tick()
+
+	last := <-stateEvents
+	assert.Equal(t, files.SortByName, last.State.SortKey)
+	assert.Equal(t, "foo/a", root.Children()[0].Path())
+}
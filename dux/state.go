@@ -1,6 +1,9 @@
 package dux
 
 import (
+	"time"
+
+	"github.com/jensgreen/dux/files"
 	"github.com/jensgreen/dux/geo/z2"
 	"github.com/jensgreen/dux/treemap"
 )
@@ -15,7 +18,66 @@ type State struct {
 	AppSize        z2.Point
 	TotalFiles     int
 	IsWalkingFiles bool
-	Pause          bool
+	// Progress is how far walking has come, while walking
+	Progress     files.ProgressStats
+	IsWatching   bool
+	IsRescanning bool
+	RescanPath   string
+	Pause        bool
+	SizeMode     files.SizeMode
+	ColorMode    ColorMode
+	// SortKey orders the children of each directory, and so their tiles
+	SortKey files.SortKey
+	// TopOwners are the users owning the most within the zoom root, most
+	// first, when coloring by owner
+	TopOwners []files.OwnerUsage
+	// TypeView shows the files below TypeRoot grouped by type, see
+	// files.GroupByType, instead of by directory. DirZoom is the zoom root to
+	// return to in the directory view.
+	TypeView bool
+	TypeRoot string
+	DirZoom  *treemap.R2Treemap
+	// FindDuplicates is set while finding, and showing, files with the same
+	// contents. IsHashing is set while hashing them, and Duplicates are the
+	// duplicates found so far.
+	FindDuplicates bool
+	IsHashing      bool
+	Duplicates     *files.Duplicates
+	// IsImported is set when files were read from a snapshot or an export
+	// rather than scanned, and so cannot be rescanned
+	IsImported bool
+	// PendingExport is an export waiting for the walk to be done
+	PendingExport *Export
+	// Notice is a message about the last command, such as where something
+	// was exported
+	Notice string
+	// SnapshotTime is when the loaded snapshot was scanned, or zero when
+	// scanning
+	SnapshotTime time.Time
+}
+
+// ColorMode selects what the colors of tiles show
+type ColorMode int
+
+const (
+	// ColorByType colors directories, symbolic links and excluded files
+	ColorByType ColorMode = iota
+	// ColorByAge shades tiles from fresh to stale by the newest modification
+	// time within them
+	ColorByAge
+	// ColorByOwner colors tiles by the user owning the most within them
+	ColorByOwner
+	numColorModes
+)
+
+func (m ColorMode) String() string {
+	switch m {
+	case ColorByAge:
+		return "age"
+	case ColorByOwner:
+		return "owner"
+	}
+	return "type"
 }
 
 type Action int
@@ -30,5 +92,16 @@ const (
 type StateEvent struct {
 	State  State
 	Action Action
-	Errors []error
+	// Replaced are the paths whose subtrees were walked anew or removed, so
+	// that the errors below them no longer apply. Errors occurred after.
+	Replaced []string
+	Errors   []error
+}
+
+// Export asks for the tree below Root, or the whole tree, to be written to
+// File in the ncdu JSON export format
+type Export struct {
+	File  string
+	Root  string
+	Whole bool
 }
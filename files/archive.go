@@ -0,0 +1,219 @@
+package files
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// archiveKind is a format of archives that can be browsed
+type archiveKind int
+
+const (
+	notArchive archiveKind = iota
+	archiveTar
+	archiveTarGz
+	archiveZip
+)
+
+// archiveKindOf tells the format of an archive by the name of the file
+func archiveKindOf(name string) archiveKind {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(name, ".zip"):
+		return archiveZip
+	}
+	return notArchive
+}
+
+// readArchive returns the members of the archive at a.Path as Files below
+// it, parents before children. The Size of a member is its uncompressed size,
+// and the DiskSize is the space it takes up in the archive. Directories not
+// in the archive, but implied by the paths of members, are included.
+func readArchive(src source, a File) ([]File, error) {
+	var members map[string]File
+	var err error
+	switch archiveKindOf(a.Path) {
+	case archiveTar, archiveTarGz:
+		members, err = readTar(src, a)
+	case archiveZip:
+		members, err = readZip(src, a)
+	default:
+		return nil, fmt.Errorf("%s: not an archive", a.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// add implied directories
+	for name := range members {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if _, ok := members[dir]; ok {
+				break
+			}
+			members[dir] = File{IsDir: true}
+		}
+	}
+
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	// parents sort before their children
+	sort.Strings(names)
+	files := make([]File, 0, len(names))
+	for _, name := range names {
+		f := members[name]
+		f.Path = filepath.Join(a.Path, filepath.FromSlash(name))
+		f.Device = a.Device
+		// the space is taken up by the archive, whoever owned the members
+		f.UID, f.GID, f.HasOwner = a.UID, a.GID, a.HasOwner
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// memberName returns the clean, relative name of an archive member, or false
+// for the archive root
+func memberName(name string) (string, bool) {
+	// also drops any ".." leading out of the archive
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return name, name != ""
+}
+
+func readTar(src source, a File) (map[string]File, error) {
+	f, err := src.open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	counter := &countingReader{r: f}
+	compressed := archiveKindOf(a.Path) == archiveTarGz
+	if compressed {
+		gz, err := gzip.NewReader(counter)
+		if err != nil {
+			return nil, &fs.PathError{Op: "gunzip", Path: a.Path, Err: err}
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	members := make(map[string]File)
+	tr := tar.NewReader(r)
+	var prev string
+	var prevCount int64
+	for {
+		hdr, err := tr.Next()
+		if compressed && prev != "" {
+			// compressed data is read ahead in blocks, so this is only
+			// approximately what the previous member takes up
+			m := members[prev]
+			m.DiskSize = counter.n - prevCount
+			members[prev] = m
+		}
+		prevCount = counter.n
+		prev = ""
+		if errors.Is(err, io.EOF) {
+			return members, nil
+		} else if err != nil {
+			return nil, &fs.PathError{Op: "untar", Path: a.Path, Err: err}
+		}
+
+		name, ok := memberName(hdr.Name)
+		if !ok {
+			continue
+		}
+		m := File{Size: hdr.Size, ModTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			m.IsDir = true
+			m.Size = 0
+		case tar.TypeSymlink:
+			m.IsSymlink = true
+			m.LinkTarget = hdr.Linkname
+		case tar.TypeXGlobalHeader:
+			continue
+		}
+		if !compressed {
+			m.DiskSize = tarBlock + roundUp(m.Size, tarBlock)
+		}
+		members[name] = m
+		prev = name
+	}
+}
+
+// tarBlock is the size of headers, and the unit of data, in tar archives
+const tarBlock = 512
+
+func roundUp(n, unit int64) int64 {
+	return (n + unit - 1) / unit * unit
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func readZip(src source, a File) (map[string]File, error) {
+	f, err := src.open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		// zip archives cannot be read sequentially
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		ra = bytes.NewReader(data)
+	}
+	zr, err := zip.NewReader(ra, a.Size)
+	if err != nil {
+		return nil, &fs.PathError{Op: "unzip", Path: a.Path, Err: err}
+	}
+
+	members := make(map[string]File)
+	for _, zf := range zr.File {
+		name, ok := memberName(zf.Name)
+		if !ok {
+			continue
+		}
+		m := File{
+			Size:     int64(zf.UncompressedSize64),
+			DiskSize: int64(zf.CompressedSize64),
+			ModTime:  zf.Modified,
+		}
+		if mode := zf.Mode(); mode.IsDir() {
+			m.IsDir = true
+		} else if mode&fs.ModeSymlink != 0 {
+			m.IsSymlink = true
+		}
+		members[name] = m
+	}
+	return members, nil
+}
@@ -0,0 +1,125 @@
+package files
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTar(t *testing.T, w io.Writer) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	for _, hdr := range []*tar.Header{
+		{Name: "./pkg/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "./pkg/big.bin", Typeflag: tar.TypeReg, Size: 1000, Mode: 0o644},
+		{Name: "./implied/dir/small.txt", Typeflag: tar.TypeReg, Size: 10, Mode: 0o644},
+		{Name: "./link", Typeflag: tar.TypeSymlink, Linkname: "pkg/big.bin"},
+		{Name: "../escaped", Typeflag: tar.TypeReg, Size: 1, Mode: 0o644},
+	} {
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write(bytes.Repeat([]byte{'x'}, int(hdr.Size)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+}
+
+func walkToFS(t *testing.T, path string) (*FS, []error) {
+	t.Helper()
+	ch := make(chan FileEvent)
+	go WalkPaths(context.Background(), []string{path}, ch, WalkOptions{})
+	fs := NewFS()
+	var errs []error
+	for event := range ch {
+		if event.Error != nil {
+			errs = append(errs, event.Error)
+		} else {
+			require.NoError(t, fs.Insert(event.File))
+		}
+	}
+	return fs, errs
+}
+
+func TestWalkPaths_Tar(t *testing.T) {
+	for _, name := range []string{"release.tar", "release.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			if filepath.Ext(name) == ".gz" {
+				gz := gzip.NewWriter(f)
+				writeTar(t, gz)
+				require.NoError(t, gz.Close())
+			} else {
+				writeTar(t, f)
+			}
+			require.NoError(t, f.Close())
+
+			fs, errs := walkToFS(t, path)
+
+			require.Empty(t, errs)
+			root, _ := fs.Root()
+			assert.True(t, root.File().IsArchive)
+			assert.True(t, root.File().IsDir)
+			assert.Equal(t, int64(1000+10+1), root.File().Size)
+			assert.True(t, findFile(t, fs, filepath.Join(path, "implied/dir")).IsDir)
+			assert.True(t, findFile(t, fs, filepath.Join(path, "link")).IsSymlink)
+			assert.Equal(t, int64(1), findFile(t, fs, filepath.Join(path, "escaped")).Size)
+			big := findFile(t, fs, filepath.Join(path, "pkg/big.bin"))
+			assert.Equal(t, int64(1000), big.Size)
+			if filepath.Ext(name) == ".gz" {
+				// repeated bytes compress well
+				assert.Less(t, root.File().DiskSize, int64(1000))
+			} else {
+				assert.Equal(t, int64(512+1024), big.DiskSize)
+			}
+		})
+	}
+}
+
+func TestWalkPaths_Zip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("docs/readme.txt")
+	require.NoError(t, err)
+	_, err = w.Write(bytes.Repeat([]byte{'x'}, 5000))
+	require.NoError(t, err)
+	w, err = zw.CreateHeader(&zip.FileHeader{Name: "stored.bin", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("12345"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	fs, errs := walkToFS(t, path)
+
+	require.Empty(t, errs)
+	readme := findFile(t, fs, filepath.Join(path, "docs/readme.txt"))
+	assert.Equal(t, int64(5000), readme.Size)
+	assert.Less(t, readme.DiskSize, int64(5000))
+	assert.True(t, findFile(t, fs, filepath.Join(path, "docs")).IsDir)
+	stored := findFile(t, fs, filepath.Join(path, "stored.bin"))
+	assert.Equal(t, stored.Size, stored.DiskSize)
+}
+
+func TestWalkPaths_InvalidArchiveIsAFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fake.zip")
+	require.NoError(t, os.WriteFile(path, []byte("not a zip"), 0o644))
+
+	fs, errs := walkToFS(t, path)
+
+	require.Len(t, errs, 1)
+	root, _ := fs.Root()
+	assert.False(t, root.File().IsDir)
+	assert.Equal(t, int64(9), root.File().Size)
+}
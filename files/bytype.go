@@ -0,0 +1,120 @@
+package files
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// NoExtension is the extension group of files without an extension
+const NoExtension = "(none)"
+
+// categories group extensions by the kind of data, checked in order
+var categories = []struct {
+	name       string
+	extensions []string
+}{
+	{"media", []string{
+		".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp", ".heic", ".raw", ".svg",
+		".mp3", ".flac", ".wav", ".ogg", ".aac", ".m4a",
+		".mp4", ".mkv", ".mov", ".avi", ".webm", ".m4v", ".mpg", ".mpeg",
+	}},
+	{"archives", []string{
+		".zip", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".7z", ".rar", ".iso", ".dmg",
+		".jar", ".war", ".deb", ".rpm", ".whl",
+	}},
+	{"source", []string{
+		".go", ".c", ".h", ".cc", ".cpp", ".hpp", ".rs", ".py", ".js", ".ts", ".tsx", ".jsx",
+		".java", ".kt", ".scala", ".rb", ".php", ".cs", ".swift", ".m", ".sh", ".pl", ".lua",
+		".hs", ".ml", ".ex", ".erl", ".clj", ".sql", ".html", ".css", ".scss",
+	}},
+	{"binaries", []string{
+		".exe", ".dll", ".so", ".dylib", ".a", ".o", ".obj", ".lib", ".bin", ".class", ".pyc",
+		".wasm", ".elf", ".ko",
+	}},
+	{"documents", []string{
+		".pdf", ".doc", ".docx", ".odt", ".xls", ".xlsx", ".ods", ".ppt", ".pptx", ".odp",
+		".txt", ".md", ".rst", ".tex", ".csv", ".json", ".xml", ".yaml", ".yml", ".toml",
+	}},
+}
+
+// categoryOf maps extensions to their category
+var categoryOf = func() map[string]string {
+	m := make(map[string]string)
+	for _, c := range categories {
+		for _, ext := range c.extensions {
+			m[ext] = c.name
+		}
+	}
+	return m
+}()
+
+// OtherCategory is the category of extensions not in any other
+const OtherCategory = "other"
+
+// Extension returns the lower case extension of the file at path, or
+// NoExtension
+func Extension(path string) string {
+	name := filepath.Base(path)
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" || ext == name {
+		// dot files such as .bashrc have no extension
+		return NoExtension
+	}
+	return ext
+}
+
+// Category returns the kind of data, such as "media" or "source", in files
+// with extension ext
+func Category(ext string) string {
+	if c, ok := categoryOf[ext]; ok {
+		return c
+	}
+	return OtherCategory
+}
+
+// GroupByType returns a hierarchy of the files within tree grouped by what
+// kind of data they hold rather than where they are. Below a root at the path
+// of tree are the categories, then the extensions, then the paths within tree
+// of the files with the extension. Directories themselves are left out, so
+// only the sizes of files add up.
+func GroupByType(tree *FileTree) *FS {
+	byType := NewFS()
+	root := tree.Path()
+	_ = byType.Insert(File{Path: root, IsDir: true})
+	insertDir := func(path string) {
+		if _, ok := byType.Find(path); !ok {
+			_ = byType.Insert(File{Path: path, IsDir: true})
+		}
+	}
+
+	var group func(node *FileTree, rel string)
+	group = func(node *FileTree, rel string) {
+		for _, c := range node.children {
+			name := filepath.Base(c.name)
+			crel := filepath.Join(rel, name)
+			if c.file.IsDir {
+				group(c, crel)
+				continue
+			}
+			ext := Extension(name)
+			categoryPath := filepath.Join(root, Category(ext))
+			extPath := filepath.Join(categoryPath, ext)
+			insertDir(categoryPath)
+			insertDir(extPath)
+			// the directories leading to the file, parents first
+			dirs := strings.Split(filepath.Dir(crel), string(filepath.Separator))
+			dir := extPath
+			for _, d := range dirs {
+				if d == "." || d == "" {
+					continue
+				}
+				dir = filepath.Join(dir, d)
+				insertDir(dir)
+			}
+
+			_ = byType.Insert(c.fileAt(filepath.Join(dir, name)))
+		}
+	}
+	group(tree, "")
+	return byType
+}
@@ -0,0 +1,62 @@
+package files_test
+
+import (
+	"testing"
+
+	"github.com/jensgreen/dux/files"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Extension(t *testing.T) {
+	assert.Equal(t, ".jpg", files.Extension("a/b/IMG_1.JPG"))
+	assert.Equal(t, ".gz", files.Extension("x.tar.gz"))
+	assert.Equal(t, files.NoExtension, files.Extension("Makefile"))
+	assert.Equal(t, files.NoExtension, files.Extension(".bashrc"))
+}
+
+func Test_GroupByType(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: "home", IsDir: true, DiskSize: 4096},
+		files.File{Path: "home/a", IsDir: true, DiskSize: 4096},
+		files.File{Path: "home/a/x.mp4", Size: 100},
+		files.File{Path: "home/a/y.go", Size: 10},
+		files.File{Path: "home/b", IsDir: true},
+		files.File{Path: "home/b/c", IsDir: true},
+		files.File{Path: "home/b/c/z.mp4", Size: 50},
+		files.File{Path: "home/Makefile", Size: 1},
+	)
+	home, _ := fs.Find("home")
+
+	byType := files.GroupByType(home)
+
+	root, ok := byType.Root()
+	require.True(t, ok)
+	assert.Equal(t, "home", root.File().Path)
+	assert.Equal(t, int64(161), root.File().Size, "only files count")
+	assert.Equal(t, int64(150), requireFile(t, byType, "home/media").Size)
+	assert.Equal(t, int64(150), requireFile(t, byType, "home/media/.mp4").Size)
+	assert.Equal(t, int64(100), requireFile(t, byType, "home/media/.mp4/a/x.mp4").Size)
+	assert.Equal(t, int64(50), requireFile(t, byType, "home/media/.mp4/b/c").Size)
+	assert.Equal(t, int64(10), requireFile(t, byType, "home/source/.go/a").Size)
+	assert.Equal(t, int64(1), requireFile(t, byType, "home/other/(none)/Makefile").Size)
+	assert.Len(t, root.Children(), 3)
+}
+
+func Test_GroupByTypeOfTotal(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: files.TotalPath, IsDir: true},
+		files.File{Path: "/srv", IsDir: true},
+		files.File{Path: "/srv/x.zip", Size: 3},
+		files.File{Path: "y.zip", Size: 4},
+	)
+	total, _ := fs.Root()
+
+	byType := files.GroupByType(total)
+
+	root, _ := byType.Root()
+	assert.True(t, root.File().Path == files.TotalPath)
+	assert.Equal(t, int64(7), requireFile(t, byType, "archives/.zip").Size)
+	assert.Equal(t, int64(3), requireFile(t, byType, "archives/.zip/srv/x.zip").Size)
+	assert.Equal(t, int64(4), requireFile(t, byType, "archives/.zip/y.zip").Size)
+}
@@ -0,0 +1,178 @@
+package files
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jensgreen/dux/cancellable"
+)
+
+// duNode is a path found in du output, or a directory implied by it
+type duNode struct {
+	path     string
+	listed   bool
+	size     int64
+	children []*duNode
+}
+
+// ReadDu reads the output of du, as lines of a size, a tab and a path, from r,
+// and sends a FileEvent for each path, like a walk would. Sizes are in units
+// of blockSize bytes, e.g. 1 for `du -ab` and 1024 for `du -k`. Lines may be
+// in any order. Directories between a listed path and its closest listed
+// ancestor are implied. Malformed lines are sent as errors and skipped.
+// fileEvents is closed when done or when ctx is cancelled.
+//
+// Paths without listed descendants are taken to be files, as in the output of
+// `du -a`. Without -a, du lists only directories, which dirsOnly is to be set
+// for: every path is then a directory, whose size without its subdirectories
+// is that of the files directly in it.
+func ReadDu(ctx context.Context, r io.Reader, blockSize int64, dirsOnly bool, fileEvents chan<- FileEvent) {
+	defer func() {
+		log.Println("Closing FileEvent channel")
+		close(fileEvents)
+	}()
+	send := func(event FileEvent) error {
+		return cancellable.Send(ctx, fileEvents, event)
+	}
+
+	nodes := make(map[string]*duNode)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		size, path, err := parseDuLine(scanner.Text())
+		if err == nil {
+			if node, ok := nodes[path]; ok && node.listed {
+				err = fmt.Errorf("duplicate path %q", path)
+			}
+		}
+		if err != nil {
+			err = send(FileEvent{Error: fmt.Errorf("du output line %d: %w", lineNum, err)})
+			if err != nil {
+				return
+			}
+			continue
+		}
+		nodes[path] = &duNode{path: path, listed: true, size: size * blockSize}
+	}
+	if err := scanner.Err(); err != nil {
+		if send(FileEvent{Error: fmt.Errorf("du output: %w", err)}) != nil {
+			return
+		}
+	}
+
+	roots := linkDuNodes(nodes)
+	if len(roots) > 1 {
+		if send(FileEvent{File: File{Path: TotalPath, IsDir: true}}) != nil {
+			return
+		}
+	}
+	for _, root := range roots {
+		root.total()
+		if sendDuNode(send, root, dirsOnly) != nil {
+			return
+		}
+	}
+}
+
+// parseDuLine parses a line such as "4096\t./dir"
+func parseDuLine(line string) (int64, string, error) {
+	sizeStr, path, ok := strings.Cut(line, "\t")
+	if !ok {
+		return 0, "", fmt.Errorf("expected a size and a path separated by a tab, got %q", line)
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < 0 {
+		return 0, "", fmt.Errorf("invalid size %q", sizeStr)
+	}
+	if path == "" {
+		return 0, "", fmt.Errorf("missing path after size %d", size)
+	}
+	return size, filepath.Clean(path), nil
+}
+
+// linkDuNodes connects each node to its closest listed ancestor, through
+// implied directories, and returns the nodes without ancestors
+func linkDuNodes(nodes map[string]*duNode) []*duNode {
+	paths := make([]string, 0, len(nodes))
+	for path := range nodes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var roots []*duNode
+	for _, path := range paths {
+		node := nodes[path]
+		if !hasListedAncestor(nodes, path) {
+			roots = append(roots, node)
+			continue
+		}
+		// link up to the closest ancestor, listed or implied
+		for {
+			parentPath := filepath.Dir(node.path)
+			parent, exists := nodes[parentPath]
+			if !exists {
+				parent = &duNode{path: parentPath}
+				nodes[parentPath] = parent
+			}
+			parent.children = append(parent.children, node)
+			if exists {
+				break
+			}
+			node = parent
+		}
+	}
+	return roots
+}
+
+func hasListedAncestor(nodes map[string]*duNode, path string) bool {
+	for parent := filepath.Dir(path); parent != path; path, parent = parent, filepath.Dir(parent) {
+		if node, ok := nodes[parent]; ok && node.listed {
+			return true
+		}
+	}
+	return false
+}
+
+// total returns the size of n including its descendants, and turns the sizes
+// of listed directories, which du reports including their descendants, into
+// their own sizes
+func (n *duNode) total() int64 {
+	var sum int64
+	for _, c := range n.children {
+		sum += c.total()
+	}
+	if !n.listed {
+		return sum
+	}
+	if n.size < sum {
+		// du counts hard links once, and rounds sizes up to blocks, so a
+		// directory can be reported smaller than the sum of its children
+		n.size = sum
+	}
+	total := n.size
+	n.size -= sum
+	return total
+}
+
+func sendDuNode(send func(FileEvent) error, n *duNode, dirsOnly bool) error {
+	f := File{Path: n.path, Size: n.size, DiskSize: n.size, IsDir: dirsOnly || len(n.children) > 0}
+	if err := send(FileEvent{File: f}); err != nil {
+		return err
+	}
+	sort.Slice(n.children, func(i, j int) bool {
+		return n.children[i].path < n.children[j].path
+	})
+	for _, c := range n.children {
+		if err := sendDuNode(send, c, dirsOnly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package files
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readDu(t *testing.T, output string, blockSize int64, dirsOnly bool) (*FS, []error) {
+	t.Helper()
+	ch := make(chan FileEvent)
+	go ReadDu(context.Background(), strings.NewReader(output), blockSize, dirsOnly, ch)
+	fs := NewFS()
+	var errs []error
+	for event := range ch {
+		if event.Error != nil {
+			errs = append(errs, event.Error)
+		} else {
+			require.NoError(t, fs.Insert(event.File))
+		}
+	}
+	return fs, errs
+}
+
+func findFile(t *testing.T, fs *FS, path string) File {
+	t.Helper()
+	node, ok := fs.Find(path)
+	require.Truef(t, ok, "%q not found", path)
+	return node.File()
+}
+
+func TestReadDu(t *testing.T) {
+	// as printed by du -ab, children first
+	output := strings.Join([]string{
+		"3\t/srv/a/b/file",
+		"4099\t/srv/a/b",
+		"8195\t/srv/a",
+		"10\t/srv/x/y/z/deep",
+		"12300\t/srv",
+		"",
+	}, "\n")
+
+	fs, errs := readDu(t, output, 1, false)
+
+	require.Empty(t, errs)
+	root, _ := fs.Root()
+	assert.Equal(t, "/srv", root.File().Path)
+	assert.Equal(t, int64(12300), root.File().Size)
+	assert.Equal(t, int64(8195), findFile(t, fs, "/srv/a").Size)
+	assert.Equal(t, int64(4099), findFile(t, fs, "/srv/a/b").Size)
+	assert.Equal(t, int64(3), findFile(t, fs, "/srv/a/b/file").Size)
+	// implied
+	y := findFile(t, fs, "/srv/x/y")
+	assert.True(t, y.IsDir)
+	assert.Equal(t, int64(10), y.Size)
+	assert.Equal(t, 7, root.File().NumDescendants)
+}
+
+func TestReadDu_BlockSizeAndSeveralRoots(t *testing.T) {
+	output := "4\tone/f\n8\tone\n2\ttwo\n"
+
+	fs, errs := readDu(t, output, 1024, false)
+
+	require.Empty(t, errs)
+	root, _ := fs.Root()
+	assert.Equal(t, TotalPath, root.File().Path)
+	assert.Equal(t, int64(10*1024), root.File().DiskSize)
+	assert.Equal(t, int64(8*1024), findFile(t, fs, "one").DiskSize)
+}
+
+func TestReadDu_DirsOnly(t *testing.T) {
+	// as printed by du -k, without -a
+	output := strings.Join([]string{
+		"8\t/srv/a/b",
+		"4\t/srv/a/empty",
+		"20\t/srv/a",
+		"24\t/srv",
+		"",
+	}, "\n")
+
+	fs, errs := readDu(t, output, 1024, true)
+
+	require.Empty(t, errs)
+	root, _ := fs.Root()
+	assert.Equal(t, int64(24*1024), root.File().DiskSize)
+	for _, path := range []string{"/srv", "/srv/a", "/srv/a/b", "/srv/a/empty"} {
+		assert.Truef(t, findFile(t, fs, path).IsDir, "%s is a directory", path)
+	}
+	assert.Equal(t, int64(8*1024), findFile(t, fs, "/srv/a/b").DiskSize)
+
+	// without dirsOnly, directories without subdirectories look like files
+	fs, errs = readDu(t, output, 1024, false)
+
+	require.Empty(t, errs)
+	assert.False(t, findFile(t, fs, "/srv/a/b").IsDir)
+	assert.Equal(t, int64(24*1024), findFile(t, fs, "/srv").DiskSize)
+}
+
+func TestReadDu_ReportsMalformedLines(t *testing.T) {
+	output := "1\ta\nnot a du line\nx\ta/b\n-1\ta/c\n2\t\n1\ta\n3\ta/d\n"
+
+	fs, errs := readDu(t, output, 1, false)
+
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	assert.Equal(t, []string{
+		`du output line 2: expected a size and a path separated by a tab, got "not a du line"`,
+		`du output line 3: invalid size "x"`,
+		`du output line 4: invalid size "-1"`,
+		`du output line 5: missing path after size 2`,
+		`du output line 6: duplicate path "a"`,
+	}, msgs)
+	assert.Equal(t, int64(3), findFile(t, fs, "a/d").Size)
+}
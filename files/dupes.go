@@ -0,0 +1,295 @@
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/jensgreen/dux/cancellable"
+)
+
+// DuplicateSet is a set of files with the same contents, each of Size bytes
+type DuplicateSet struct {
+	Size  int64
+	Paths []string
+}
+
+// Wasted is the number of bytes taken up by all but one of the copies
+func (s DuplicateSet) Wasted() int64 {
+	return s.Size * int64(len(s.Paths)-1)
+}
+
+// DuplicateCandidates returns groups of the regular files within tree that
+// have the same size, and so may have the same contents, largest first. Empty
+// files, links and archive members are left out, as are all but one of the
+// hard links to an inode, which take up no more space than one. Summarized
+// files are not in the tree, so they are left out too.
+func DuplicateCandidates(tree *FileTree) []DuplicateSet {
+	bySize := make(map[int64][]string)
+	// collected are the inodes of hard links already collected, which are
+	// all counted with --count-links
+	collected := make(map[inode]bool)
+	var collect func(node *FileTree, path string)
+	collect = func(node *FileTree, path string) {
+		f := node.file
+		switch {
+		case f.IsArchive:
+			// members cannot be opened by path
+			return
+		case f.IsDir:
+			for _, c := range node.children {
+				collect(c, c.childPath(path))
+			}
+		case f.IsSymlink, f.IsDuplicateLink, f.Excluded != NotExcluded, f.Size == 0:
+		case node.extra != nil && node.extra.inode != 0:
+			key := inode{device: node.device(), inode: node.extra.inode}
+			if collected[key] {
+				return
+			}
+			collected[key] = true
+			bySize[f.Size] = append(bySize[f.Size], path)
+		default:
+			bySize[f.Size] = append(bySize[f.Size], path)
+		}
+	}
+	collect(tree, tree.Path())
+
+	var candidates []DuplicateSet
+	for size, paths := range bySize {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			candidates = append(candidates, DuplicateSet{Size: size, Paths: paths})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Size > candidates[j].Size
+	})
+	return candidates
+}
+
+// partialHashSize is how much of each file is hashed to tell files apart
+// before hashing them completely
+const partialHashSize = 64 * 1024
+
+// HashDuplicates hashes the contents of the files in candidates with jobs
+// workers, and sends the sets of files found to have the same contents.
+// Files that cannot be read are left out. Reading is limited by throttle, if
+// set. sets is closed when done or when ctx is cancelled.
+func HashDuplicates(ctx context.Context, candidates []DuplicateSet, jobs int, throttle *Throttle, sets chan<- DuplicateSet) {
+	defer func() {
+		log.Println("Closing DuplicateSet channel")
+		close(sets)
+	}()
+	if jobs < 1 {
+		jobs = 1
+	}
+	send := func(set DuplicateSet) error {
+		return cancellable.Send(ctx, sets, set)
+	}
+
+	// tell most files apart by their beginnings, before reading them whole
+	var partial []DuplicateSet
+	err := hashGroups(ctx, candidates, partialHashSize, jobs, throttle, func(size int64, paths []string) error {
+		if size <= partialHashSize {
+			return send(DuplicateSet{Size: size, Paths: paths})
+		}
+		partial = append(partial, DuplicateSet{Size: size, Paths: paths})
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	_ = hashGroups(ctx, partial, -1, jobs, throttle, func(size int64, paths []string) error {
+		return send(DuplicateSet{Size: size, Paths: paths})
+	})
+}
+
+type hashJob struct {
+	group int
+	path  string
+}
+
+type hashResult struct {
+	hashJob
+	sum string
+	err error
+}
+
+// hashGroups hashes up to limit bytes, or all if negative, of the files in
+// groups with jobs workers. As soon as the files of a group are hashed, found
+// is called with each set of files in it with the same hash.
+func hashGroups(ctx context.Context, groups []DuplicateSet, limit int64, jobs int, throttle *Throttle, found func(size int64, paths []string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobQueue := make(chan hashJob)
+	results := make(chan hashResult)
+	go func() {
+		defer close(jobQueue)
+		for i, g := range groups {
+			for _, path := range g.Paths {
+				if cancellable.Send(ctx, jobQueue, hashJob{group: i, path: path}) != nil {
+					return
+				}
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobQueue {
+				sum, err := hashFile(ctx, throttle, job.path, limit)
+				if cancellable.Send(ctx, results, hashResult{hashJob: job, sum: sum, err: err}) != nil {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	remaining := make([]int, len(groups))
+	byHash := make([]map[string][]string, len(groups))
+	for i, g := range groups {
+		remaining[i] = len(g.Paths)
+		byHash[i] = make(map[string][]string)
+	}
+	var err error
+	for r := range results {
+		if r.err != nil {
+			log.Printf("cannot hash %s: %v", r.path, r.err)
+		} else {
+			byHash[r.group][r.sum] = append(byHash[r.group][r.sum], r.path)
+		}
+		remaining[r.group]--
+		if remaining[r.group] > 0 || err != nil {
+			continue
+		}
+		for _, paths := range sortedSets(byHash[r.group]) {
+			if err = found(groups[r.group].Size, paths); err != nil {
+				// stop the workers, and drain what they already hashed
+				cancel()
+				break
+			}
+		}
+		byHash[r.group] = nil
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// sortedSets returns the sets of more than one path in byHash, in order
+func sortedSets(byHash map[string][]string) [][]string {
+	var sets [][]string
+	for _, paths := range byHash {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			sets = append(sets, paths)
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		return sets[i][0] < sets[j][0]
+	})
+	return sets
+}
+
+func hashFile(ctx context.Context, throttle *Throttle, path string, limit int64) (string, error) {
+	if err := throttle.Wait(ctx); err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return string(h.Sum(nil)), nil
+}
+
+// Duplicates are the sets of duplicate files found, and what they waste in
+// each directory. Duplicates are not changed once made.
+type Duplicates struct {
+	// Sets are the duplicate sets, the most wasteful first
+	Sets   []DuplicateSet
+	setOf  map[string]int
+	wasted map[string]int64
+	total  int64
+}
+
+// NewDuplicates indexes sets. The first path of each set is counted as the
+// original, and the other paths as wasting space in their directories.
+func NewDuplicates(sets []DuplicateSet) *Duplicates {
+	d := &Duplicates{
+		Sets:   append([]DuplicateSet(nil), sets...),
+		setOf:  make(map[string]int),
+		wasted: make(map[string]int64),
+	}
+	sort.SliceStable(d.Sets, func(i, j int) bool {
+		return d.Sets[i].Wasted() > d.Sets[j].Wasted()
+	})
+	for i, s := range d.Sets {
+		for j, path := range s.Paths {
+			d.setOf[path] = i
+			if j == 0 {
+				continue
+			}
+			for p := path; ; p = filepath.Dir(p) {
+				d.wasted[p] += s.Size
+				if filepath.Dir(p) == p {
+					break
+				}
+			}
+		}
+		d.total += s.Wasted()
+	}
+	d.wasted[TotalPath] = d.total
+	return d
+}
+
+// SetOf returns the set of duplicates that the file at path is in
+func (d *Duplicates) SetOf(path string) (DuplicateSet, bool) {
+	if d == nil {
+		return DuplicateSet{}, false
+	}
+	i, ok := d.setOf[path]
+	if !ok {
+		return DuplicateSet{}, false
+	}
+	return d.Sets[i], true
+}
+
+// Wasted returns the bytes taken up by copies of files within path, not
+// counting the originals
+func (d *Duplicates) Wasted(path string) int64 {
+	if d == nil {
+		return 0
+	}
+	return d.wasted[path]
+}
+
+// TotalWasted returns the bytes taken up by all copies
+func (d *Duplicates) TotalWasted() int64 {
+	if d == nil {
+		return 0
+	}
+	return d.total
+}
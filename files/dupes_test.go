@@ -0,0 +1,107 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DuplicateCandidatesGroupsBySize(t *testing.T) {
+	fs := NewFS()
+	for _, f := range []File{
+		{Path: "a", IsDir: true},
+		{Path: "a/x", Size: 3},
+		{Path: "a/y", Size: 3},
+		{Path: "a/z", Size: 4},
+		{Path: "a/link", Size: 3, IsSymlink: true},
+		{Path: "a/hard", IsDuplicateLink: true},
+		{Path: "a/empty1"},
+		{Path: "a/empty2"},
+		{Path: "a/b", IsDir: true},
+		{Path: "a/b/w", Size: 3},
+		{Path: "a/t.zip", IsDir: true, IsArchive: true},
+		{Path: "a/t.zip/m", Size: 3},
+	} {
+		require.NoError(t, fs.Insert(f))
+	}
+	root, _ := fs.Root()
+
+	got := DuplicateCandidates(root)
+
+	assert.Equal(t, []DuplicateSet{{Size: 3, Paths: []string{"a/b/w", "a/x", "a/y"}}}, got)
+}
+
+func Test_DuplicateCandidatesCollectsOneLinkPerInode(t *testing.T) {
+	fs := NewFS()
+	for _, f := range []File{
+		{Path: "a", IsDir: true, Device: 1},
+		// links counted with --count-links
+		{Path: "a/x", Size: 3, Device: 1, Inode: 7, NumLinks: 2},
+		{Path: "a/y", Size: 3, Device: 1, Inode: 7, NumLinks: 2},
+		// the same inode number on another device is another file
+		{Path: "a/mnt", IsDir: true, Device: 2},
+		{Path: "a/mnt/z", Size: 3, Device: 2, Inode: 7, NumLinks: 2},
+	} {
+		require.NoError(t, fs.Insert(f))
+	}
+	root, _ := fs.Root()
+
+	got := DuplicateCandidates(root)
+
+	require.Len(t, got, 1)
+	assert.Len(t, got[0].Paths, 2)
+	assert.Contains(t, got[0].Paths, "a/mnt/z")
+}
+
+func Test_HashDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	big := bytes.Repeat([]byte("x"), partialHashSize+10)
+	bigOther := append(bytes.Repeat([]byte("x"), partialHashSize+9), 'y')
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		return path
+	}
+	candidates := []DuplicateSet{
+		{Size: int64(len(big)), Paths: []string{write("big1", big), write("big2", big), write("big3", bigOther)}},
+		{Size: 3, Paths: []string{write("a1", []byte("aaa")), write("a2", []byte("aaa")), write("b", []byte("bbb")), write("b2", []byte("bbb"))}},
+		{Size: 3, Paths: []string{write("c", []byte("ccc")), filepath.Join(dir, "gone")}},
+	}
+
+	sets := make(chan DuplicateSet)
+	go HashDuplicates(context.Background(), candidates, 2, nil, sets)
+	var got []DuplicateSet
+	for s := range sets {
+		got = append(got, s)
+	}
+
+	assert.ElementsMatch(t, []DuplicateSet{
+		{Size: int64(len(big)), Paths: []string{filepath.Join(dir, "big1"), filepath.Join(dir, "big2")}},
+		{Size: 3, Paths: []string{filepath.Join(dir, "a1"), filepath.Join(dir, "a2")}},
+		{Size: 3, Paths: []string{filepath.Join(dir, "b"), filepath.Join(dir, "b2")}},
+	}, got)
+}
+
+func Test_DuplicatesWastedPerDirectory(t *testing.T) {
+	d := NewDuplicates([]DuplicateSet{
+		{Size: 10, Paths: []string{"/r/a/x", "/r/b/x", "/r/b/y"}},
+		{Size: 100, Paths: []string{"/r/a/big", "/r/c/big"}},
+	})
+
+	assert.Equal(t, int64(100), d.Sets[0].Size, "most wasteful first")
+	assert.Equal(t, int64(120), d.TotalWasted())
+	assert.Equal(t, int64(120), d.Wasted("/r"))
+	assert.Equal(t, int64(0), d.Wasted("/r/a"), "originals waste nothing")
+	assert.Equal(t, int64(20), d.Wasted("/r/b"))
+	assert.Equal(t, int64(10), d.Wasted("/r/b/x"))
+	set, ok := d.SetOf("/r/b/y")
+	require.True(t, ok)
+	assert.Equal(t, int64(10), set.Size)
+	_, ok = (*Duplicates)(nil).SetOf("/r/b/y")
+	assert.False(t, ok)
+}
@@ -1,23 +1,93 @@
 package files
 
 import (
-	"context"
-	"errors"
-	"log"
 	"os"
 	"path/filepath"
-	"syscall"
-
-	"github.com/jensgreen/dux/cancellable"
+	"sort"
+	"strings"
+	"time"
 )
 
 type ReadDir = func(dirname string) ([]os.DirEntry, error)
 
 type File struct {
-	Path           string
-	Size           int64
+	Path string
+	// Size is the apparent size, i.e. the number of bytes in the file
+	Size int64
+	// DiskSize is the number of bytes allocated for the file on disk
+	DiskSize       int64
 	IsDir          bool
 	NumDescendants int
+	// NumSummarized counts the files directly within a directory that are
+	// counted in its weights, but not kept in the hierarchy, see FSOptions
+	NumSummarized int
+	// Device and Inode identify the file on the system, when known
+	Device uint64
+	Inode  uint64
+	// NumLinks is the number of hard links to the inode. An FS only keeps
+	// the Inode and NumLinks of hard links to files other than directories.
+	NumLinks uint64
+	// IsDuplicateLink is set on hard links, or followed symbolic links, to an
+	// inode whose size has already been counted elsewhere. Both sizes of a
+	// duplicate link are zero, and duplicate directories are not walked.
+	IsDuplicateLink bool
+	// IsSymlink is set on symbolic links, whether followed or not, and
+	// LinkTarget is the path they point to
+	IsSymlink  bool
+	LinkTarget string
+	// Excluded is set on files and directories that were found but not
+	// walked. NumExcluded counts excluded descendants.
+	Excluded    Exclusion
+	NumExcluded int
+	// IsArchive is set on archive files shown as directories of their
+	// members. Members have uncompressed sizes as Size, and the space they
+	// take up in the archive as DiskSize.
+	IsArchive bool
+	// ReadError is set on files and directories that could not be read
+	// completely. NumErrors counts the errors of the file and its
+	// descendants, see FileTree.Errors.
+	ReadError bool
+	NumErrors int
+	// ModTime is when the file was last modified, or zero when unknown.
+	// NewestModTime is the latest ModTime of the file and its descendants.
+	ModTime       time.Time
+	NewestModTime time.Time
+	// UID and GID are the owner and group of the file, when HasOwner is set.
+	// MainUID is the user owning the most disk usage within a directory,
+	// and the owner of anything else.
+	UID      uint32
+	GID      uint32
+	HasOwner bool
+	MainUID  uint32
+}
+
+// SizeOf returns the apparent size or the disk usage of the file
+func (f File) SizeOf(mode SizeMode) int64 {
+	if mode == ApparentSize {
+		return f.Size
+	}
+	return f.DiskSize
+}
+
+// TotalPath is the path of the synthetic root directory holding the roots of
+// a walk of several paths
+const TotalPath = ""
+
+// IsTotal reports whether f is the synthetic root of a walk of several paths
+func (f *File) IsTotal() bool {
+	return f.Path == TotalPath
+}
+
+// IsWithin reports whether path is dir or below it. Every path is within the
+// synthetic total.
+func IsWithin(path string, dir string) bool {
+	if dir == TotalPath || path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
 }
 
 func (f *File) Dir() string {
@@ -28,14 +98,269 @@ func (f *File) Name() string {
 	return filepath.Base(f.Path)
 }
 
+// SizeMode selects which size of a File is used for layout and display
+type SizeMode int
+
+const (
+	DiskUsage SizeMode = iota
+	ApparentSize
+)
+
+func (m SizeMode) String() string {
+	if m == ApparentSize {
+		return "apparent size"
+	}
+	return "disk usage"
+}
+
+// Exclusion tells why a file or the contents of a directory were not walked
+type Exclusion int8
+
+const (
+	NotExcluded Exclusion = iota
+	// ExcludedOtherFS is a mount point of another filesystem
+	ExcludedOtherFS
+	// ExcludedPattern matches an exclude pattern
+	ExcludedPattern
+)
+
+func (e Exclusion) String() string {
+	switch e {
+	case ExcludedOtherFS:
+		return "other filesystem"
+	case ExcludedPattern:
+		return "excluded"
+	}
+	return ""
+}
+
+// FileTree is a node in a hierarchy of files. Only the last segment of the
+// path is stored in each node, and full paths are rebuilt on demand, see Path.
+// Of the rest of the File, what most files have is stored inline, and what
+// few files have is stored in extra.
 type FileTree struct {
-	file     File
+	// name is the last segment of the path, or the whole path of a root and
+	// of the children of the synthetic total
+	name     string
+	file     treeFile
 	parent   *FileTree
 	children []*FileTree
+	// owners of directories, see Owners
+	owners ownerTotals
+	// extra is only allocated for the few nodes that need it
+	extra *treeExtra
+}
+
+// treeFile is the part of a File stored inline in a FileTree. Times are in
+// nanoseconds since the epoch, or 0 when unknown, and so come back in local
+// time, see unixNano.
+type treeFile struct {
+	Size            int64
+	DiskSize        int64
+	NumDescendants  int
+	ModTime         int64
+	NewestModTime   int64
+	UID             uint32
+	GID             uint32
+	MainUID         uint32
+	IsDir           bool
+	IsDuplicateLink bool
+	IsSymlink       bool
+	IsArchive       bool
+	ReadError       bool
+	HasOwner        bool
+	Excluded        Exclusion
+}
+
+// SizeOf returns the apparent size or the disk usage of the file
+func (f treeFile) SizeOf(mode SizeMode) int64 {
+	if mode == ApparentSize {
+		return f.Size
+	}
+	return f.DiskSize
+}
+
+// treeExtra holds what most nodes do without, to keep them small
+type treeExtra struct {
+	errs []error
+	// byName are the children of large directories, sorted by name
+	byName []*FileTree
+	// summarized are the weights of the files within a directory that are
+	// counted in its sizes, but not kept as nodes of their own, and
+	// summarizedModTime is the newest of their modification times
+	summarized        weights
+	summarizedModTime int64
+	numSummarized     int
+	numExcluded       int
+	numErrors         int
+	// device is only stored where it differs from that of the parent, see
+	// FileTree.device. inode and numLinks are only stored for hard links to
+	// files other than directories.
+	device     uint64
+	inode      uint64
+	numLinks   uint64
+	linkTarget string
+}
+
+// indexedChildren is the number of children above which they are indexed by
+// name, rather than searched
+const indexedChildren = 32
+
+// unixNano returns t in nanoseconds since the epoch, or 0 if t is zero
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// timeOf returns the time of nanoseconds since the epoch, see unixNano
+func timeOf(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
 }
 
 func (ft *FileTree) File() File {
-	return ft.file
+	return ft.fileAt(ft.Path())
+}
+
+// fileAt returns the File of ft, given its path
+func (ft *FileTree) fileAt(path string) File {
+	tf := ft.file
+	f := File{
+		Path:            path,
+		Size:            tf.Size,
+		DiskSize:        tf.DiskSize,
+		IsDir:           tf.IsDir,
+		NumDescendants:  tf.NumDescendants,
+		Device:          ft.device(),
+		IsDuplicateLink: tf.IsDuplicateLink,
+		IsSymlink:       tf.IsSymlink,
+		Excluded:        tf.Excluded,
+		IsArchive:       tf.IsArchive,
+		ReadError:       tf.ReadError,
+		ModTime:         timeOf(tf.ModTime),
+		NewestModTime:   timeOf(tf.NewestModTime),
+		UID:             tf.UID,
+		GID:             tf.GID,
+		HasOwner:        tf.HasOwner,
+		MainUID:         tf.MainUID,
+	}
+	if extra := ft.extra; extra != nil {
+		f.NumSummarized = extra.numSummarized
+		f.NumExcluded = extra.numExcluded
+		f.NumErrors = extra.numErrors
+		f.Inode = extra.inode
+		f.NumLinks = extra.numLinks
+		f.LinkTarget = extra.linkTarget
+	}
+	return f
+}
+
+// setFile stores f in ft, apart from its path. The parent of ft is expected
+// to be set already, as the device is only stored if it differs from that of
+// the parent.
+func (ft *FileTree) setFile(f File) {
+	ft.file = treeFile{
+		Size:            f.Size,
+		DiskSize:        f.DiskSize,
+		NumDescendants:  f.NumDescendants,
+		ModTime:         unixNano(f.ModTime),
+		NewestModTime:   unixNano(f.NewestModTime),
+		UID:             f.UID,
+		GID:             f.GID,
+		MainUID:         f.MainUID,
+		IsDir:           f.IsDir,
+		IsDuplicateLink: f.IsDuplicateLink,
+		IsSymlink:       f.IsSymlink,
+		IsArchive:       f.IsArchive,
+		ReadError:       f.ReadError,
+		HasOwner:        f.HasOwner,
+		Excluded:        f.Excluded,
+	}
+
+	var parentDevice uint64
+	if ft.parent != nil {
+		parentDevice = ft.parent.device()
+	}
+	var device, inode, numLinks uint64
+	if f.Device != parentDevice {
+		device = f.Device
+	}
+	// every directory has several links, from its parent and its
+	// subdirectories, so only those of other files tell of hard links
+	if (f.NumLinks > 1 && !f.IsDir) || f.IsDuplicateLink {
+		device, inode, numLinks = f.Device, f.Inode, f.NumLinks
+	}
+	if ft.extra == nil && device == 0 && inode == 0 && numLinks == 0 && f.LinkTarget == "" &&
+		f.NumSummarized == 0 && f.NumExcluded == 0 && f.NumErrors == 0 {
+		return
+	}
+	extra := ft.extras()
+	extra.device, extra.inode, extra.numLinks = device, inode, numLinks
+	extra.linkTarget = f.LinkTarget
+	extra.numSummarized = f.NumSummarized
+	extra.numExcluded = f.NumExcluded
+	extra.numErrors = f.NumErrors
+}
+
+// device returns the device of ft, which is that of the closest of ft and its
+// ancestors that has one stored, see treeExtra
+func (ft *FileTree) device() uint64 {
+	for node := ft; node != nil; node = node.parent {
+		if node.extra != nil && node.extra.device != 0 {
+			return node.extra.device
+		}
+	}
+	return 0
+}
+
+// Path returns the path of the file, rebuilt from the names of ft and its
+// ancestors
+func (ft *FileTree) Path() string {
+	if ft.isTopLevel() {
+		return ft.name
+	}
+	var names []string
+	node := ft
+	for ; !node.isTopLevel(); node = node.parent {
+		names = append(names, node.name)
+	}
+	names = append(names, node.name)
+	// root first
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return filepath.Join(names...)
+}
+
+// childPath returns the path of ft, given the path of its parent, without
+// walking the ancestors again
+func (ft *FileTree) childPath(parentPath string) string {
+	if ft.isTopLevel() {
+		return ft.name
+	}
+	return filepath.Join(parentPath, ft.name)
+}
+
+// isTopLevel reports whether the name of ft is its whole path
+func (ft *FileTree) isTopLevel() bool {
+	return ft.parent == nil || ft.parent.isTotal()
+}
+
+// isTotal reports whether ft is the synthetic root of several paths
+func (ft *FileTree) isTotal() bool {
+	return ft.parent == nil && ft.name == TotalPath
+}
+
+// Errors returns the errors that occurred reading the file itself
+func (ft *FileTree) Errors() []error {
+	if ft.extra == nil {
+		return nil
+	}
+	return ft.extra.errs
 }
 
 func (ft *FileTree) Parent() (*FileTree, bool) {
@@ -46,101 +371,126 @@ func (ft *FileTree) Children() []*FileTree {
 	return ft.children[:]
 }
 
+// SetParent moves ft below parent, keeping its name. A tree without a parent
+// keeps its whole path as its name.
 func (ft *FileTree) SetParent(parent *FileTree) {
+	path := ft.Path()
 	ft.parent = parent
+	ft.name = path
+	if !ft.isTopLevel() {
+		ft.name = filepath.Base(path)
+	}
 }
 
 func (ft *FileTree) AddChildren(children ...*FileTree) {
-	ft.children = append(ft.children, children...)
+	for _, c := range children {
+		ft.addChild(c)
+	}
 }
 
-func NewFileTree(f File) *FileTree {
-	return &FileTree{file: f}
+// addChild appends child, and indexes it if ft has many children
+func (ft *FileTree) addChild(child *FileTree) {
+	ft.children = append(ft.children, child)
+	switch {
+	case ft.extra != nil && ft.extra.byName != nil:
+		i, _ := ft.searchByName(child.name)
+		byName := append(ft.extra.byName, nil)
+		copy(byName[i+1:], byName[i:])
+		byName[i] = child
+		ft.extra.byName = byName
+	case len(ft.children) > indexedChildren:
+		byName := make([]*FileTree, len(ft.children))
+		copy(byName, ft.children)
+		sort.Slice(byName, func(i, j int) bool {
+			return byName[i].name < byName[j].name
+		})
+		ft.extras().byName = byName
+	}
 }
 
-type FileEvent struct {
-	File  File
-	Error error
+// searchByName returns the index in the name index of ft that name is at, or
+// would be inserted at, and whether it is there
+func (ft *FileTree) searchByName(name string) (int, bool) {
+	byName := ft.extra.byName
+	i := sort.Search(len(byName), func(i int) bool {
+		return byName[i].name >= name
+	})
+	return i, i < len(byName) && byName[i].name == name
 }
 
-func WalkDir(ctx context.Context, path string, fileEvents chan<- FileEvent, readDir ReadDir) {
-	defer func() {
-		log.Println("Closing FileEvent channel")
-		close(fileEvents)
-	}()
-
-	path = filepath.Clean(path)
-	rootInfo, err := os.Stat(path)
-	if err != nil {
-		err := cancellable.Send(ctx, fileEvents, FileEvent{Error: err})
-		if err != nil {
-			return
-		}
-	} else if !rootInfo.IsDir() {
-		// TODO handle file
-		err := cancellable.Send(ctx, fileEvents, FileEvent{Error: syscall.ENOTDIR})
-		if err != nil {
-			return
-		}
-	} else {
-		f := File{
-			Path:  path,
-			Size:  0,
-			IsDir: true,
+// child returns the child named name
+func (ft *FileTree) child(name string) (*FileTree, bool) {
+	if ft.extra != nil && ft.extra.byName != nil {
+		if i, ok := ft.searchByName(name); ok {
+			return ft.extra.byName[i], true
 		}
-		log.Println("Sending FileEvent for", f.Path)
-		err := cancellable.Send(ctx, fileEvents, FileEvent{File: f})
-		if err != nil {
-			return
+		return nil, false
+	}
+	for _, c := range ft.children {
+		if c.name == name {
+			return c, true
 		}
+	}
+	return nil, false
+}
 
-		err = walkDir(ctx, path, f, fileEvents, readDir)
-		if err != nil {
-			return
-		}
+// unindex removes child from the name index of ft, if any
+func (ft *FileTree) unindex(child *FileTree) {
+	if ft.extra == nil || ft.extra.byName == nil {
+		return
+	}
+	if i, ok := ft.searchByName(child.name); ok && ft.extra.byName[i] == child {
+		byName := ft.extra.byName
+		copy(byName[i:], byName[i+1:])
+		byName[len(byName)-1] = nil
+		ft.extra.byName = byName[:len(byName)-1]
 	}
 }
 
-func walkDir(ctx context.Context, path string, parent File, fileEvents chan<- FileEvent, readDir ReadDir) error {
-	entries, err := readDir(path)
-	if err != nil {
-		err := cancellable.Send(ctx, fileEvents, FileEvent{Error: err})
-		if err != nil {
-			return err
+func (ft *FileTree) removeChild(child *FileTree) {
+	for i, c := range ft.children {
+		if c == child {
+			last := len(ft.children) - 1
+			copy(ft.children[i:], ft.children[i+1:])
+			ft.children[last] = nil
+			ft.children = ft.children[:last]
+			ft.unindex(c)
+			return
 		}
 	}
+}
 
-	for _, entry := range entries {
-		var size int64 = 0
-		path := filepath.Join(parent.Path, entry.Name())
-		if !entry.IsDir() {
-			info, err := entry.Info()
-			if err != nil {
-				err := cancellable.Send(ctx, fileEvents, FileEvent{Error: err})
-				if err != nil {
-					return err
-				}
-				continue
-			} else {
-				size = info.Size()
-			}
-		}
-		f := File{
-			Path:  path,
-			Size:  size,
-			IsDir: entry.IsDir(),
-		}
-		log.Println("Sending FileEvent for", f.Path)
-		err := cancellable.Send(ctx, fileEvents, FileEvent{File: f})
-		if err != nil {
-			return err
-		}
-		if f.IsDir {
-			err := walkDir(ctx, f.Path, f, fileEvents, readDir)
-			if errors.Is(cancellable.ErrClosed, err) {
-				return err
-			}
-		}
+// extras returns the extra fields of ft, allocating them if needed
+func (ft *FileTree) extras() *treeExtra {
+	if ft.extra == nil {
+		ft.extra = &treeExtra{}
 	}
-	return nil
+	return ft.extra
+}
+
+func NewFileTree(f File) *FileTree {
+	ft := &FileTree{name: f.Path}
+	ft.setFile(f)
+	return ft
+}
+
+// FileEventKind tells how a FileEvent changes the hierarchy of files
+type FileEventKind int
+
+const (
+	// FileCreated adds a file, or updates it if it already exists
+	FileCreated FileEventKind = iota
+	// FileRemoved removes a file and its descendants
+	FileRemoved
+	// FileUpdated changes the metadata of an existing file
+	FileUpdated
+	// FileReplaced puts Tree at the path of File, replacing what was there
+	FileReplaced
+)
+
+type FileEvent struct {
+	Kind  FileEventKind
+	File  File
+	Tree  *FileTree
+	Error error
 }
@@ -3,8 +3,13 @@ package files
 import (
 	"context"
 	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -113,6 +118,260 @@ func TestWalkDir_SetsFileSize(t *testing.T) {
 	}
 }
 
+func TestWalk_ParallelSendsParentsBeforeChildren(t *testing.T) {
+	ch := make(chan FileEvent)
+
+	go Walk(context.Background(), "../testdata", ch, WalkOptions{ReadDir: os.ReadDir, Jobs: 4})
+
+	seen := map[string]bool{}
+	for event := range ch {
+		require.NoError(t, event.Error)
+		f := event.File
+		if len(seen) > 0 {
+			assert.Truef(t, seen[f.Dir()], "got %q before its parent", f.Path)
+		}
+		seen[f.Path] = true
+	}
+
+	want := []string{
+		"../testdata",
+		"../testdata/example",
+		"../testdata/example/inner",
+		"../testdata/example/inner/a.txt",
+		"../testdata/example/inner/b.txt",
+		"../testdata/example/inner/nested",
+		"../testdata/example/inner/nested/innermost.txt",
+		"../testdata/example/outer.txt",
+	}
+	for _, path := range want {
+		assert.Truef(t, seen[path], "missing %q", path)
+	}
+	assert.Len(t, seen, len(want))
+}
+
+func TestWalk_ClosesChannelWhenCancelled(t *testing.T) {
+	ch := make(chan FileEvent)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		Walk(ctx, "../testdata", ch, WalkOptions{ReadDir: os.ReadDir, Jobs: 4})
+		close(done)
+	}()
+	<-ch
+	cancel()
+	<-done
+
+	_, ok := <-ch
+	assert.False(t, ok, "expected closed channel")
+}
+
+func TestWalk_CountsHardLinksOnce(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), []byte("hello"), 0o644))
+	require.NoError(t, os.Link(filepath.Join(dir, "a"), filepath.Join(dir, "b")))
+
+	tests := []struct {
+		countLinks bool
+		want       int64
+	}{
+		{countLinks: false, want: 5},
+		{countLinks: true, want: 10},
+	}
+	for _, tt := range tests {
+		ch := make(chan FileEvent, 10)
+		Walk(context.Background(), dir, ch, WalkOptions{CountLinks: tt.countLinks})
+
+		var total int64
+		var duplicates int
+		for event := range ch {
+			require.NoError(t, event.Error)
+			total += event.File.Size
+			if event.File.IsDuplicateLink {
+				duplicates++
+				assert.Zero(t, event.File.DiskSize)
+			}
+		}
+		assert.Equal(t, tt.want, total, "countLinks: %v", tt.countLinks)
+		if tt.countLinks {
+			assert.Zero(t, duplicates)
+		} else {
+			assert.Equal(t, 1, duplicates)
+		}
+	}
+}
+
+type fakeDirEntry struct {
+	name string
+	stat syscall.Stat_t
+}
+
+func (e fakeDirEntry) Name() string               { return e.name }
+func (e fakeDirEntry) IsDir() bool                { return true }
+func (e fakeDirEntry) Type() fs.FileMode          { return fs.ModeDir }
+func (e fakeDirEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e fakeDirEntry) Size() int64                { return 0 }
+func (e fakeDirEntry) Mode() fs.FileMode          { return fs.ModeDir }
+func (e fakeDirEntry) ModTime() time.Time         { return time.Time{} }
+func (e fakeDirEntry) Sys() any                   { return &e.stat }
+
+func TestWalk_OneFileSystemSkipsOtherDevices(t *testing.T) {
+	root := t.TempDir()
+	var rootStat syscall.Stat_t
+	require.NoError(t, syscall.Stat(root, &rootStat))
+
+	var walked []string
+	readDir := func(dirname string) ([]os.DirEntry, error) {
+		walked = append(walked, dirname)
+		if dirname != root {
+			return nil, nil
+		}
+		return []os.DirEntry{
+			fakeDirEntry{name: "local", stat: syscall.Stat_t{Dev: rootStat.Dev}},
+			fakeDirEntry{name: "mnt", stat: syscall.Stat_t{Dev: rootStat.Dev + 1}},
+		}, nil
+	}
+
+	ch := make(chan FileEvent, 10)
+	Walk(context.Background(), root, ch, WalkOptions{ReadDir: readDir, OneFileSystem: true})
+
+	excluded := map[string]Exclusion{}
+	for event := range ch {
+		require.NoError(t, event.Error)
+		excluded[event.File.Name()] = event.File.Excluded
+	}
+	assert.Equal(t, NotExcluded, excluded["local"])
+	assert.Equal(t, ExcludedOtherFS, excluded["mnt"])
+	assert.Equal(t, []string{root, filepath.Join(root, "local")}, walked)
+}
+
+func TestWalk_SkipsExcludedAndGitIgnored(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"keep.txt", "drop.log", "sub/keep.log", "sub/secret", "node_modules/x/y"} {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("x"), 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", ".gitignore"), []byte("secret\n"), 0o644))
+
+	exclude := &Patterns{}
+	exclude.Add("*.log", "")
+	exclude.Add("!sub/keep.log", "")
+	exclude.Add("node_modules/", "")
+
+	ch := make(chan FileEvent, 20)
+	Walk(context.Background(), root, ch, WalkOptions{Exclude: exclude, GitIgnore: true})
+
+	got := map[string]Exclusion{}
+	for event := range ch {
+		require.NoError(t, event.Error)
+		rel, err := filepath.Rel(root, event.File.Path)
+		require.NoError(t, err)
+		got[filepath.ToSlash(rel)] = event.File.Excluded
+	}
+	want := map[string]Exclusion{
+		".":              NotExcluded,
+		"keep.txt":       NotExcluded,
+		"drop.log":       ExcludedPattern,
+		"sub":            NotExcluded,
+		"sub/.gitignore": NotExcluded,
+		"sub/keep.log":   NotExcluded,
+		"sub/secret":     ExcludedPattern,
+		"node_modules":   ExcludedPattern,
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestWalk_Symlinks(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "real"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "real", "file"), []byte("hello"), 0o644))
+	require.NoError(t, os.Symlink("real", filepath.Join(root, "link")))
+	require.NoError(t, os.Symlink(".", filepath.Join(root, "loop")))
+
+	walk := func(follow bool) map[string]File {
+		ch := make(chan FileEvent, 20)
+		Walk(context.Background(), root, ch, WalkOptions{FollowSymlinks: follow})
+		got := map[string]File{}
+		for event := range ch {
+			require.NoError(t, event.Error)
+			rel, err := filepath.Rel(root, event.File.Path)
+			require.NoError(t, err)
+			got[filepath.ToSlash(rel)] = event.File
+		}
+		return got
+	}
+
+	t.Run("not followed", func(t *testing.T) {
+		got := walk(false)
+		assert.Len(t, got, 5)
+		assert.True(t, got["link"].IsSymlink)
+		assert.False(t, got["link"].IsDir)
+		assert.Equal(t, "real", got["link"].LinkTarget)
+		assert.False(t, got["real"].IsSymlink)
+	})
+
+	t.Run("followed", func(t *testing.T) {
+		got := walk(true)
+		assert.True(t, got["loop"].IsDuplicateLink, "expected cycle to be detected")
+		assert.True(t, got["link"].IsSymlink)
+		assert.True(t, got["link"].IsDir)
+		// real/ and link/ are the same directory, only one of them is walked
+		assert.NotEqual(t, got["real"].IsDuplicateLink, got["link"].IsDuplicateLink)
+		var total int64
+		for _, f := range got {
+			total += f.Size
+		}
+		assert.Equal(t, int64(5), total)
+	})
+}
+
+func TestWalk_FileAsRoot(t *testing.T) {
+	ch := make(chan FileEvent, 10)
+
+	Walk(context.Background(), "../testdata/example/outer.txt", ch, WalkOptions{})
+
+	event, ok := <-ch
+	require.True(t, ok)
+	require.NoError(t, event.Error)
+	assert.Equal(t, "../testdata/example/outer.txt", event.File.Path)
+	assert.Equal(t, int64(45), event.File.Size)
+	assert.False(t, event.File.IsDir)
+	_, ok = <-ch
+	assert.False(t, ok, "expected closed channel")
+}
+
+func TestWalkPaths_SendsTotalAsRoot(t *testing.T) {
+	ch := make(chan FileEvent, 20)
+	paths := []string{
+		"../testdata/example/inner/nested",
+		"../testdata/example/outer.txt",
+		"../testdata/example/inner/nested/innermost.txt", // inside another path
+		"../testdata/example/inner/nested/",              // same as another path
+	}
+
+	WalkPaths(context.Background(), paths, ch, WalkOptions{})
+
+	fs := NewFS()
+	for event := range ch {
+		require.NoError(t, event.Error)
+		require.NoError(t, fs.Insert(event.File))
+	}
+	root, ok := fs.Root()
+	require.True(t, ok)
+	assert.Equal(t, TotalPath, root.Path())
+	_, hasParent := root.Parent()
+	assert.False(t, hasParent)
+	assert.True(t, root.File().IsDir)
+	assert.Equal(t, int64(15+45), root.File().Size)
+	assert.Equal(t, 3, root.File().NumDescendants)
+	var names []string
+	for _, c := range root.Children() {
+		names = append(names, filepath.Base(c.File().Path))
+	}
+	assert.Equal(t, []string{"nested", "outer.txt"}, names)
+}
+
 func TestFile_DirName(t *testing.T) {
 	tests := []struct {
 		file File
@@ -173,3 +432,14 @@ func TestFile_DirName(t *testing.T) {
 		assert.Equalf(t, tt.name, gotName, "Name() of %q: got %q, want %q", tt.file.Path, gotName, tt.name)
 	}
 }
+
+func TestFS_InternsNames(t *testing.T) {
+	fs := NewFS()
+	for _, path := range []string{"r", "r/a", "r/b", "r/a/node_modules", "r/b/node_modules"} {
+		require.NoError(t, fs.Insert(File{Path: path, IsDir: true}))
+	}
+
+	a, _ := fs.Find("r/a/node_modules")
+	b, _ := fs.Find("r/b/node_modules")
+	assert.Equal(t, unsafe.StringData(a.name), unsafe.StringData(b.name))
+}
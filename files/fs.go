@@ -3,11 +3,40 @@ package files
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 )
 
+// FS is a hierarchy of files, with the weights of each directory aggregated
+// from its contents. Names are interned, so that a name found in many
+// directories is only stored once.
 type FS struct {
-	root       *FileTree
-	pathLookup map[string]*FileTree
+	root  *FileTree
+	opts  FSOptions
+	names map[string]string
+	// version counts changes, see Version
+	version uint64
+}
+
+// FSOptions configures an FS
+type FSOptions struct {
+	// SummarizeBelow, if above 0, keeps files other than directories out of
+	// the hierarchy when they are more than SummarizeBelow levels below a
+	// root. They are only counted in the weights of their directory, and
+	// cannot be found, updated or removed. Inserting one again counts it
+	// again.
+	SummarizeBelow int
+	// RootDepth is the depth of the root in the hierarchy that the FS is to
+	// be put in with ReplaceSubtree, see SubtreeOptions
+	RootDepth int
+	// Order is the order of the children of each directory, see SetOrder.
+	// By default, the largest come first.
+	Order Order
+}
+
+// Version changes whenever the hierarchy or any file in it does, to tell
+// when what is derived from it is out of date
+func (fs *FS) Version() uint64 {
+	return fs.version
 }
 
 func (fs *FS) Root() (*FileTree, bool) {
@@ -15,41 +44,480 @@ func (fs *FS) Root() (*FileTree, bool) {
 }
 
 func (fs *FS) Find(path string) (*FileTree, bool) {
-	node, ok := fs.pathLookup[path]
-	return node, ok
+	root := fs.root
+	switch {
+	case root == nil:
+		return nil, false
+	case !root.isTotal():
+		return root.find(root.name, path)
+	case path == TotalPath:
+		return root, true
+	}
+	// the children of the total are named by their paths
+	for p := path; ; p = filepath.Dir(p) {
+		if c, ok := root.child(p); ok {
+			return c.find(p, path)
+		}
+		if filepath.Dir(p) == p {
+			return nil, false
+		}
+	}
+}
+
+// find returns the node at path below ft, which is at base
+func (ft *FileTree) find(base string, path string) (*FileTree, bool) {
+	rel, ok := relPath(base, path)
+	if !ok {
+		return nil, false
+	}
+	node := ft
+	for rel != "" {
+		name, rest, _ := strings.Cut(rel, string(filepath.Separator))
+		if node, ok = node.child(name); !ok {
+			return nil, false
+		}
+		rel = rest
+	}
+	return node, true
 }
 
-// Insert a File to the hierarchy, update weights and relationships
+// relPath returns path relative to base, or "" if they are the same. Both
+// are expected to be clean.
+func relPath(base string, path string) (string, bool) {
+	sep := string(filepath.Separator)
+	switch {
+	case path == base:
+		return "", true
+	case base == ".":
+		if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+sep) {
+			return "", false
+		}
+		return path, true
+	case strings.HasSuffix(base, sep):
+		// the root directory
+		rel, ok := strings.CutPrefix(path, base)
+		return rel, ok
+	case strings.HasPrefix(path, base+sep):
+		return path[len(base)+1:], true
+	}
+	return "", false
+}
+
+// intern returns the stored copy of name, storing it first if new
+func (fs *FS) intern(name string) string {
+	if stored, ok := fs.names[name]; ok {
+		return stored
+	}
+	// name is usually part of a longer path, which is not to be kept
+	name = strings.Clone(name)
+	fs.names[name] = name
+	return name
+}
+
+// depth returns how many levels below a root ft is, the children of the
+// total being roots
+func (fs *FS) depth(ft *FileTree) int {
+	depth := fs.opts.RootDepth
+	for node := ft; !node.isTopLevel(); node = node.parent {
+		depth++
+	}
+	return depth
+}
+
+// SubtreeOptions returns the options of an FS to put at path with
+// ReplaceSubtree, so that it is summarized as if it were inserted here
+func (fs *FS) SubtreeOptions(path string) FSOptions {
+	opts := fs.opts
+	if node, ok := fs.Find(path); ok {
+		opts.RootDepth = fs.depth(node)
+	} else if parent, ok := fs.Find(filepath.Dir(path)); ok {
+		opts.RootDepth = fs.depth(parent) + 1
+	}
+	return opts
+}
+
+// summarizes reports whether f is to be summarized in parent
+func (fs *FS) summarizes(parent *FileTree, f File) bool {
+	if fs.opts.SummarizeBelow <= 0 || f.IsDir || parent.isTotal() {
+		return false
+	}
+	return fs.depth(parent)+1 > fs.opts.SummarizeBelow
+}
+
+// Insert a File to the hierarchy, update weights and relationships. When the
+// root is the synthetic total of several paths, files without a parent in the
+// hierarchy become children of the root. Inserting a path that already exists
+// updates it, see Update.
 func (fs *FS) Insert(f File) error {
+	fs.version++
 	cleanPath := filepath.Clean(f.Path)
-	if f.Path != cleanPath {
+	if f.Path != cleanPath && !f.IsTotal() {
 		return fmt.Errorf("path %q has shorter filepath.Clean equivalent %q", f.Path, cleanPath)
 	}
+	if _, ok := fs.Find(f.Path); ok {
+		return fs.Update(f)
+	}
 
-	tree := &FileTree{file: f}
-	fs.pathLookup[f.Path] = tree
+	// weights are aggregated from descendants as they are inserted
+	f.NumDescendants = 0
+	f.NumSummarized = 0
+	f.NumExcluded = 0
+	f.NumErrors = 0
+	f.NewestModTime = f.ModTime
+	f.MainUID = f.UID
 
 	if _, ok := fs.Root(); !ok {
-		fs.root = tree
+		fs.root = NewFileTree(f)
+		fs.root.adjustOwners(ownUsage(f), false)
 		return nil
 	}
 
 	parentPath := f.Dir()
-	parent, ok := fs.pathLookup[parentPath]
+	parent, ok := fs.Find(parentPath)
+	if parentPath == f.Path {
+		// "/" and "." are their own parents
+		ok = false
+	}
+	if ok && fs.summarizes(parent, f) {
+		fs.summarize(parent, f)
+		return nil
+	}
+
+	name := f.Path
+	if ok && !parent.isTotal() {
+		name = fs.intern(f.Name())
+	}
+	tree := &FileTree{name: name}
+	if !ok && fs.root.isTotal() {
+		parent, ok = fs.root, true
+	}
+	if ok {
+		tree.parent = parent
+	}
+	tree.setFile(f)
 	if ok {
-		tree.SetParent(parent)
-		parent.AddChildren(tree)
+		fs.insertChild(parent, tree)
+		fs.adjustWeights(parent, weightsOf(tree))
+		fs.touch(parent, tree.file.ModTime)
+	}
+	tree.adjustOwners(ownUsage(f), false)
+	return nil
+}
+
+// summarize counts f in the weights of ft, without keeping it
+func (fs *FS) summarize(ft *FileTree, f File) {
+	w := weights{size: f.Size, diskSize: f.DiskSize, numDescendants: 1}
+	if f.Excluded != NotExcluded {
+		w.numExcluded = 1
+	}
+	modTime := unixNano(f.ModTime)
+	extra := ft.extras()
+	extra.summarized = extra.summarized.plus(w)
+	if modTime > extra.summarizedModTime {
+		extra.summarizedModTime = modTime
+	}
+	extra.numSummarized++
+	fs.adjustWeights(ft, w)
+	fs.touch(ft, modTime)
+	ft.adjustOwners(ownUsage(f), false)
+}
+
+// Remove a file, and all its descendants, from the hierarchy, and subtract
+// their weights from the ancestors. The root cannot be removed.
+func (fs *FS) Remove(path string) error {
+	fs.version++
+	node, ok := fs.Find(path)
+	if !ok {
+		return fmt.Errorf("no such file: %q", path)
+	}
+	parent, ok := node.Parent()
+	if !ok {
+		return fmt.Errorf("cannot remove root %q", path)
+	}
+
+	parent.removeChild(node)
+	node.SetParent(nil)
+	fs.adjustWeights(parent, weightsOf(node).negate())
+	fs.refreshNewestModTime(parent)
+	parent.adjustOwners(ownersOf(node), true)
+	return nil
+}
+
+// Update replaces the metadata of an existing file, and adjusts the weights of
+// its ancestors by the change in size. For directories, the sizes of f are
+// those of the directory itself, not including its contents.
+func (fs *FS) Update(f File) error {
+	fs.version++
+	node, ok := fs.Find(f.Path)
+	if !ok {
+		return fmt.Errorf("no such file: %q", f.Path)
+	}
+
+	cur := node.File()
+	// weights of the node itself, excluding descendants
+	var size, diskSize int64 = cur.Size, cur.DiskSize
+	for _, c := range node.children {
+		size -= c.file.Size
+		diskSize -= c.file.DiskSize
+	}
+	if node.extra != nil {
+		size -= node.extra.summarized.size
+		diskSize -= node.extra.summarized.diskSize
+	}
+	delta := weights{size: f.Size - size, diskSize: f.DiskSize - diskSize}
+	if f.Excluded != cur.Excluded {
+		if f.Excluded == NotExcluded {
+			delta.numExcluded = -1
+		} else if cur.Excluded == NotExcluded {
+			delta.numExcluded = 1
+		}
+	}
+
+	// what the node owns by itself, which may change hands
+	old := cur
+	old.Size, old.DiskSize = size, diskSize
+	oldOwned, newOwned := ownUsage(old), ownUsage(f)
+
+	// changed along with the ancestors below
+	f.Size = cur.Size
+	f.DiskSize = cur.DiskSize
+	f.NumDescendants = cur.NumDescendants
+	f.NumSummarized = cur.NumSummarized
+	f.NumExcluded = cur.NumExcluded
+	f.NumErrors = cur.NumErrors
+	f.ReadError = f.ReadError || len(node.Errors()) > 0
+	f.NewestModTime = cur.NewestModTime
+	f.MainUID = f.UID
+	if f.IsDir {
+		f.MainUID = cur.MainUID
 	}
+	node.setFile(f)
+	node.adjustOwners(oldOwned, true)
+	node.adjustOwners(newOwned, false)
 
-	for ; ok; parent, ok = parent.Parent() {
-		parent.file.Size += f.Size
-		parent.file.NumDescendants++
+	fs.adjustWeights(node, weights{size: delta.size, diskSize: delta.diskSize})
+	if parent, ok := node.Parent(); ok && delta.numExcluded != 0 {
+		// excluded descendants of the parent
+		fs.adjustWeights(parent, weights{numExcluded: delta.numExcluded})
 	}
+	// the modification time may have gone back, e.g. when restored
+	fs.refreshNewestModTime(node)
 	return nil
 }
 
+// ReplaceSubtree puts tree at path, either in place of an existing file and
+// its descendants, or as a new child of the directory of path. The subtree is
+// moved to path, wherever it was before. The weights of tree are expected to
+// be aggregated, as done by Insert, and the FS takes ownership of tree.
+func (fs *FS) ReplaceSubtree(path string, tree *FileTree) error {
+	fs.version++
+	if tree == nil {
+		return fmt.Errorf("no subtree to put at %q", path)
+	}
+
+	old, exists := fs.Find(path)
+	switch {
+	case exists && old == fs.root:
+		fs.root = tree
+		tree.parent = nil
+		tree.name = path
+		fs.adopt(tree)
+		return nil
+	case exists:
+		parent := old.parent
+		tree.parent = parent
+		tree.name = old.name
+		parent.removeChild(old)
+		old.SetParent(nil)
+		fs.adopt(tree)
+		fs.insertChild(parent, tree)
+		fs.adjustWeights(parent, weightsOf(tree).minus(weightsOf(old)))
+		fs.refreshNewestModTime(parent)
+		parent.adjustOwners(ownersOf(old), true)
+		parent.adjustOwners(ownersOf(tree), false)
+		return nil
+	}
+
+	parentPath := filepath.Dir(path)
+	parent, ok := fs.Find(parentPath)
+	if parentPath == path {
+		ok = false
+	}
+	if !ok && fs.root != nil && fs.root.isTotal() {
+		parent, ok = fs.root, true
+	}
+	if !ok {
+		return fmt.Errorf("no parent directory for %q", path)
+	}
+	tree.parent = parent
+	tree.name = path
+	if !parent.isTotal() {
+		tree.name = fs.intern(filepath.Base(path))
+	}
+	fs.adopt(tree)
+	fs.insertChild(parent, tree)
+	fs.adjustWeights(parent, weightsOf(tree))
+	fs.touch(parent, tree.file.NewestModTime)
+	parent.adjustOwners(ownersOf(tree), false)
+	return nil
+}
+
+// adopt interns the names below node, which may come from another FS, and
+// puts the children of each directory in order
+func (fs *FS) adopt(node *FileTree) {
+	for _, c := range node.children {
+		if !c.isTopLevel() {
+			c.name = fs.intern(c.name)
+		}
+		fs.adopt(c)
+	}
+	fs.sortChildren(node)
+}
+
+// AddError attaches err to the file at path, or to its closest ancestor in the
+// hierarchy if the file itself is not in it, flags it as not completely read,
+// and counts the error in the NumErrors of it and its ancestors. Reports
+// whether a file to attach err to was found.
+func (fs *FS) AddError(path string, err error) bool {
+	fs.version++
+	node, ok := fs.findClosest(path)
+	if !ok {
+		return false
+	}
+	extra := node.extras()
+	extra.errs = append(extra.errs, err)
+	node.file.ReadError = true
+	fs.adjustWeights(node, weights{numErrors: 1})
+	return true
+}
+
+// findClosest returns the node at path, or its closest ancestor
+func (fs *FS) findClosest(path string) (*FileTree, bool) {
+	for {
+		if node, ok := fs.Find(path); ok {
+			return node, true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+	if fs.root != nil && fs.root.isTotal() {
+		return fs.root, true
+	}
+	return nil, false
+}
+
+// weights are the values of a File that are aggregated over its descendants
+type weights struct {
+	size           int64
+	diskSize       int64
+	numDescendants int
+	numExcluded    int
+	numErrors      int
+}
+
+// weightsOf returns what node adds to the weights of its ancestors
+func weightsOf(node *FileTree) weights {
+	f := node.file
+	w := weights{
+		size:           f.Size,
+		diskSize:       f.DiskSize,
+		numDescendants: 1 + f.NumDescendants,
+	}
+	if node.extra != nil {
+		w.numExcluded = node.extra.numExcluded
+		w.numErrors = node.extra.numErrors
+	}
+	if f.Excluded != NotExcluded {
+		w.numExcluded++
+	}
+	return w
+}
+
+func (w weights) minus(other weights) weights {
+	return weights{
+		size:           w.size - other.size,
+		diskSize:       w.diskSize - other.diskSize,
+		numDescendants: w.numDescendants - other.numDescendants,
+		numExcluded:    w.numExcluded - other.numExcluded,
+		numErrors:      w.numErrors - other.numErrors,
+	}
+}
+
+func (w weights) plus(other weights) weights {
+	return w.minus(other.negate())
+}
+
+func (w weights) negate() weights {
+	return weights{}.minus(w)
+}
+
+// adjustWeights adds delta to the weights of ft and all its ancestors, and
+// keeps them in order among their siblings
+func (fs *FS) adjustWeights(ft *FileTree, delta weights) {
+	bySize := fs.opts.Order.Key == SortBySize && (delta.size != 0 || delta.diskSize != 0)
+	for node, ok := ft, true; ok; node, ok = node.Parent() {
+		old := fs.opts.Order.keyOf(node)
+		node.file.Size += delta.size
+		node.file.DiskSize += delta.diskSize
+		node.file.NumDescendants += delta.numDescendants
+		if delta.numExcluded != 0 || delta.numErrors != 0 {
+			extra := node.extras()
+			extra.numExcluded += delta.numExcluded
+			extra.numErrors += delta.numErrors
+		}
+		if bySize {
+			fs.reposition(node, old)
+		}
+	}
+}
+
+// touch makes t the NewestModTime of ft and its ancestors, where newer
+func (fs *FS) touch(ft *FileTree, t int64) {
+	for node, ok := ft, true; ok && t > node.file.NewestModTime; node, ok = node.Parent() {
+		fs.setNewestModTime(node, t)
+	}
+}
+
+// refreshNewestModTime recomputes the NewestModTime of ft and its ancestors
+// from their children, for when a newer time may have gone away
+func (fs *FS) refreshNewestModTime(ft *FileTree) {
+	for node, ok := ft, true; ok; node, ok = node.Parent() {
+		newest := node.file.ModTime
+		if node.extra != nil && node.extra.summarizedModTime > newest {
+			newest = node.extra.summarizedModTime
+		}
+		for _, c := range node.children {
+			if c.file.NewestModTime > newest {
+				newest = c.file.NewestModTime
+			}
+		}
+		if newest == node.file.NewestModTime {
+			return
+		}
+		fs.setNewestModTime(node, newest)
+	}
+}
+
+func (fs *FS) setNewestModTime(ft *FileTree, t int64) {
+	if fs.opts.Order.Key != SortByModTime {
+		ft.file.NewestModTime = t
+		return
+	}
+	old := fs.opts.Order.keyOf(ft)
+	ft.file.NewestModTime = t
+	fs.reposition(ft, old)
+}
+
 func NewFS() *FS {
+	return NewFSWithOptions(FSOptions{})
+}
+
+func NewFSWithOptions(opts FSOptions) *FS {
 	return &FS{
-		pathLookup: make(map[string]*FileTree),
+		opts:  opts,
+		names: make(map[string]string),
 	}
 }
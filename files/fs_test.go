@@ -2,8 +2,11 @@ package files_test
 
 import (
 	"fmt"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/jensgreen/dux/files"
 	"github.com/stretchr/testify/assert"
@@ -105,3 +108,500 @@ func Test_InsertBubblesUpSize(t *testing.T) {
 		})
 	}
 }
+
+func Test_InsertBubblesUpDiskSize(t *testing.T) {
+	tb := files.NewFS()
+	require.NoError(t, tb.Insert(files.File{Path: "foo", Size: 0, DiskSize: 4096, IsDir: true}))
+	require.NoError(t, tb.Insert(files.File{Path: "foo/bar", Size: 10, DiskSize: 4096}))
+	require.NoError(t, tb.Insert(files.File{Path: "foo/sparse", Size: 1 << 30, DiskSize: 8192}))
+
+	root, ok := tb.Root()
+	require.True(t, ok)
+	assert.Equal(t, int64(10+1<<30), root.File().SizeOf(files.ApparentSize))
+	assert.Equal(t, int64(4096+4096+8192), root.File().SizeOf(files.DiskUsage))
+}
+
+func Test_InsertUnderTotal(t *testing.T) {
+	tb := files.NewFS()
+	require.NoError(t, tb.Insert(files.File{Path: files.TotalPath, IsDir: true}))
+	require.NoError(t, tb.Insert(files.File{Path: ".", IsDir: true}))
+	require.NoError(t, tb.Insert(files.File{Path: "/", IsDir: true}))
+	require.NoError(t, tb.Insert(files.File{Path: "/foo", Size: 2}))
+	require.NoError(t, tb.Insert(files.File{Path: "../bar", Size: 4}))
+
+	root, ok := tb.Root()
+	require.True(t, ok)
+	assert.Len(t, root.Children(), 3)
+	assert.Equal(t, int64(6), root.File().Size)
+	slash, ok := tb.Find("/")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), slash.File().Size)
+}
+
+func newTestFS(t *testing.T, fileList ...files.File) *files.FS {
+	t.Helper()
+	fs := files.NewFS()
+	for _, f := range fileList {
+		require.NoError(t, fs.Insert(f))
+	}
+	return fs
+}
+
+func requireFile(t *testing.T, fs *files.FS, path string) files.File {
+	t.Helper()
+	node, ok := fs.Find(path)
+	require.Truef(t, ok, "%q not found", path)
+	return node.File()
+}
+
+func Test_RemoveSubtractsWeightsAndForgetsDescendants(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true},
+		files.File{Path: "a/b", IsDir: true},
+		files.File{Path: "a/b/c", Size: 4},
+		files.File{Path: "a/b/d", Excluded: files.ExcludedPattern},
+		files.File{Path: "a/e", Size: 1},
+	)
+
+	require.NoError(t, fs.Remove("a/b"))
+
+	root := requireFile(t, fs, "a")
+	assert.Equal(t, int64(1), root.Size)
+	assert.Equal(t, 1, root.NumDescendants)
+	assert.Equal(t, 0, root.NumExcluded)
+	_, ok := fs.Find("a/b/c")
+	assert.False(t, ok)
+	assert.Error(t, fs.Remove("a/b"), "already removed")
+	assert.Error(t, fs.Remove("a"), "root")
+}
+
+func Test_UpdateAdjustsAncestors(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true, DiskSize: 4096},
+		files.File{Path: "a/b", IsDir: true, DiskSize: 4096},
+		files.File{Path: "a/b/c", Size: 4, DiskSize: 4096},
+	)
+
+	require.NoError(t, fs.Update(files.File{Path: "a/b/c", Size: 10000, DiskSize: 12288}))
+	// sizes of a directory itself, without contents
+	require.NoError(t, fs.Update(files.File{Path: "a/b", IsDir: true, DiskSize: 8192}))
+
+	assert.Equal(t, int64(10000), requireFile(t, fs, "a").Size)
+	assert.Equal(t, int64(4096+8192+12288), requireFile(t, fs, "a").DiskSize)
+	assert.Equal(t, int64(8192+12288), requireFile(t, fs, "a/b").DiskSize)
+	assert.Equal(t, 1, requireFile(t, fs, "a/b").NumDescendants)
+	assert.Error(t, fs.Update(files.File{Path: "a/nope"}))
+}
+
+func Test_InsertExistingUpdates(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true},
+		files.File{Path: "a/b", Size: 1},
+		files.File{Path: "a/b", Size: 3},
+	)
+
+	root := requireFile(t, fs, "a")
+	assert.Equal(t, int64(3), root.Size)
+	assert.Equal(t, 1, root.NumDescendants)
+}
+
+func Test_ReplaceSubtree(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true},
+		files.File{Path: "a/b", IsDir: true},
+		files.File{Path: "a/b/old", Size: 100},
+		files.File{Path: "a/c", Size: 1},
+	)
+	fresh := newTestFS(t,
+		files.File{Path: "a/b", IsDir: true},
+		files.File{Path: "a/b/new1", Size: 2},
+		files.File{Path: "a/b/new2", Size: 3, Excluded: files.ExcludedPattern},
+	)
+	subtree, _ := fresh.Root()
+
+	require.NoError(t, fs.ReplaceSubtree("a/b", subtree))
+
+	root, _ := fs.Root()
+	assert.Equal(t, int64(1+2+3), root.File().Size)
+	assert.Equal(t, 4, root.File().NumDescendants)
+	assert.Equal(t, 1, root.File().NumExcluded)
+	assert.Equal(t, "a/b", root.Children()[0].File().Path, "expected same position among siblings")
+	_, ok := fs.Find("a/b/old")
+	assert.False(t, ok)
+	assert.Equal(t, int64(2), requireFile(t, fs, "a/b/new1").Size)
+}
+
+func Test_ReplaceSubtreeMovesToNewPath(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true},
+		files.File{Path: "a/from", IsDir: true},
+		files.File{Path: "a/from/x", Size: 5},
+	)
+	moved, _ := fs.Find("a/from")
+	require.NoError(t, fs.Remove("a/from"))
+
+	require.NoError(t, fs.ReplaceSubtree("a/to", moved))
+
+	assert.Equal(t, int64(5), requireFile(t, fs, "a").Size)
+	assert.Equal(t, 2, requireFile(t, fs, "a").NumDescendants)
+	assert.Equal(t, int64(5), requireFile(t, fs, "a/to/x").Size)
+	node, _ := fs.Find("a/to/x")
+	parent, _ := node.Parent()
+	assert.Equal(t, "a/to", parent.File().Path)
+	assert.Error(t, fs.ReplaceSubtree("nope/x", files.NewFileTree(files.File{Path: "x"})))
+}
+
+func Test_InsertBubblesUpNewestModTime(t *testing.T) {
+	// times come back in local time
+	old := time.Date(2001, 1, 1, 0, 0, 0, 0, time.Local)
+	newer := old.AddDate(10, 0, 0)
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true, ModTime: old},
+		files.File{Path: "a/b", IsDir: true, ModTime: old},
+		files.File{Path: "a/b/c", ModTime: newer},
+		files.File{Path: "a/d", ModTime: old.AddDate(1, 0, 0)},
+	)
+
+	assert.Equal(t, newer, requireFile(t, fs, "a").NewestModTime)
+	assert.Equal(t, newer, requireFile(t, fs, "a/b").NewestModTime)
+	assert.Equal(t, old, requireFile(t, fs, "a").ModTime, "own time unchanged")
+	assert.Equal(t, newer, requireFile(t, fs, "a/b/c").NewestModTime)
+}
+
+func Test_RemoveAndUpdateRecomputeNewestModTime(t *testing.T) {
+	// times come back in local time
+	old := time.Date(2001, 1, 1, 0, 0, 0, 0, time.Local)
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true, ModTime: old},
+		files.File{Path: "a/b", ModTime: old.AddDate(2, 0, 0)},
+		files.File{Path: "a/c", ModTime: old.AddDate(5, 0, 0)},
+	)
+
+	require.NoError(t, fs.Remove("a/c"))
+	assert.Equal(t, old.AddDate(2, 0, 0), requireFile(t, fs, "a").NewestModTime)
+
+	// e.g. restored from a backup
+	require.NoError(t, fs.Update(files.File{Path: "a/b", ModTime: old.AddDate(1, 0, 0)}))
+	assert.Equal(t, old.AddDate(1, 0, 0), requireFile(t, fs, "a").NewestModTime)
+	assert.Equal(t, old.AddDate(1, 0, 0), requireFile(t, fs, "a/b").NewestModTime)
+}
+
+func Test_OwnersAreAggregatedPerDirectory(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true, DiskSize: 1, UID: 0, HasOwner: true},
+		files.File{Path: "a/b", IsDir: true, DiskSize: 1, UID: 1000, HasOwner: true},
+		files.File{Path: "a/b/c", DiskSize: 10, UID: 1000, HasOwner: true},
+		files.File{Path: "a/b/d", DiskSize: 100, UID: 1001, HasOwner: true},
+		files.File{Path: "a/e", DiskSize: 5, UID: 1000, HasOwner: true},
+		files.File{Path: "a/unknown", DiskSize: 1000},
+	)
+
+	root, _ := fs.Root()
+	assert.Equal(t, []files.OwnerUsage{
+		{UID: 1001, DiskSize: 100, NumFiles: 1},
+		{UID: 1000, DiskSize: 16, NumFiles: 3},
+		{UID: 0, DiskSize: 1, NumFiles: 1},
+	}, root.Owners())
+	assert.Equal(t, uint32(1001), root.File().MainUID)
+	assert.Equal(t, uint32(1001), requireFile(t, fs, "a/b").MainUID)
+	assert.Equal(t, uint32(1000), requireFile(t, fs, "a/e").MainUID)
+
+	require.NoError(t, fs.Remove("a/b/d"))
+	assert.Equal(t, uint32(1000), requireFile(t, fs, "a").MainUID)
+
+	// chown
+	require.NoError(t, fs.Update(files.File{Path: "a/e", DiskSize: 5, UID: 0, HasOwner: true}))
+	root, _ = fs.Root()
+	assert.Equal(t, []files.OwnerUsage{
+		{UID: 1000, DiskSize: 11, NumFiles: 2},
+		{UID: 0, DiskSize: 6, NumFiles: 2},
+	}, root.Owners())
+}
+
+func Test_VersionChangesOnEveryChange(t *testing.T) {
+	fs := newTestFS(t, files.File{Path: "a", IsDir: true})
+	v := fs.Version()
+
+	require.NoError(t, fs.Insert(files.File{Path: "a/b"}))
+	assert.NotEqual(t, v, fs.Version())
+	v = fs.Version()
+	require.NoError(t, fs.Remove("a/b"))
+	assert.NotEqual(t, v, fs.Version())
+}
+
+func Test_AddErrorCountsUpTheTree(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true},
+		files.File{Path: "a/b", IsDir: true},
+		files.File{Path: "a/c", IsDir: true},
+	)
+	errB := fmt.Errorf("permission denied")
+
+	assert.True(t, fs.AddError("a/b", errB))
+	// not in the tree, e.g. could not be stat'ed
+	assert.True(t, fs.AddError("a/b/gone", fmt.Errorf("no such file")))
+	assert.True(t, fs.AddError("a/c", fmt.Errorf("i/o error")))
+	assert.False(t, fs.AddError("elsewhere", fmt.Errorf("lost")))
+
+	b, _ := fs.Find("a/b")
+	assert.Len(t, b.Errors(), 2)
+	assert.Equal(t, errB, b.Errors()[0])
+	assert.True(t, b.File().ReadError)
+	assert.Equal(t, 2, b.File().NumErrors)
+	assert.Equal(t, 3, requireFile(t, fs, "a").NumErrors)
+
+	require.NoError(t, fs.Update(files.File{Path: "a/b", IsDir: true}))
+	assert.True(t, requireFile(t, fs, "a/b").ReadError, "kept on update")
+	require.NoError(t, fs.Remove("a/b"))
+	assert.Equal(t, 1, requireFile(t, fs, "a").NumErrors)
+}
+
+func Test_FindRebuildsPathsBelowAnyRoot(t *testing.T) {
+	for _, root := range []string{"/", ".", "a", "../a"} {
+		t.Run(root, func(t *testing.T) {
+			fs := newTestFS(t, files.File{Path: root, IsDir: true})
+			dir := filepath.Join(root, "d")
+			file := filepath.Join(dir, "f")
+			require.NoError(t, fs.Insert(files.File{Path: dir, IsDir: true}))
+			require.NoError(t, fs.Insert(files.File{Path: file, Size: 1}))
+
+			node, ok := fs.Find(file)
+			require.True(t, ok)
+			assert.Equal(t, file, node.File().Path)
+			assert.Equal(t, file, node.Path())
+			_, ok = fs.Find(filepath.Join(root, "nope"))
+			assert.False(t, ok)
+		})
+	}
+}
+
+func Test_FindInLargeDirectories(t *testing.T) {
+	fs := newTestFS(t, files.File{Path: "a", IsDir: true})
+	for i := 0; i < 100; i++ {
+		require.NoError(t, fs.Insert(files.File{Path: fmt.Sprintf("a/%d", i), Size: 1}))
+	}
+	require.NoError(t, fs.Remove("a/50"))
+	require.NoError(t, fs.ReplaceSubtree("a/60", files.NewFileTree(files.File{Path: "elsewhere", Size: 2})))
+
+	_, ok := fs.Find("a/50")
+	assert.False(t, ok)
+	assert.Equal(t, int64(2), requireFile(t, fs, "a/60").Size)
+	assert.Equal(t, int64(99+1), requireFile(t, fs, "a").Size)
+	for _, i := range []int{0, 49, 51, 99} {
+		requireFile(t, fs, fmt.Sprintf("a/%d", i))
+	}
+}
+
+func Test_RemovedSubtreeKeepsItsPaths(t *testing.T) {
+	fs := newTestFS(t,
+		files.File{Path: "a", IsDir: true},
+		files.File{Path: "a/b", IsDir: true},
+		files.File{Path: "a/b/c"},
+	)
+	node, _ := fs.Find("a/b/c")
+
+	require.NoError(t, fs.Remove("a/b"))
+
+	assert.Equal(t, "a/b/c", node.File().Path)
+}
+
+func Test_SummarizeBelowDepthKeepsOnlyDirectories(t *testing.T) {
+	fs := files.NewFSWithOptions(files.FSOptions{SummarizeBelow: 1})
+	for _, f := range []files.File{
+		{Path: "a", IsDir: true},
+		{Path: "a/kept", Size: 1},
+		{Path: "a/b", IsDir: true},
+		{Path: "a/b/x", Size: 2, HasOwner: true, UID: 7},
+		{Path: "a/b/y", Size: 4},
+	} {
+		require.NoError(t, fs.Insert(f))
+	}
+
+	_, ok := fs.Find("a/b/x")
+	assert.False(t, ok, "expected summarized file")
+	requireFile(t, fs, "a/kept")
+	b := requireFile(t, fs, "a/b")
+	assert.Equal(t, int64(6), b.Size)
+	assert.Equal(t, 2, b.NumSummarized)
+	assert.Equal(t, 2, b.NumDescendants)
+	assert.Equal(t, uint32(7), b.MainUID)
+	assert.Equal(t, int64(7), requireFile(t, fs, "a").Size)
+	assert.Equal(t, 4, requireFile(t, fs, "a").NumDescendants)
+
+	// the directory itself changes, but not what is summarized in it
+	require.NoError(t, fs.Update(files.File{Path: "a/b", IsDir: true, Size: 10}))
+	assert.Equal(t, int64(16), requireFile(t, fs, "a/b").Size)
+	assert.Equal(t, 2, requireFile(t, fs, "a/b").NumSummarized)
+}
+
+func Test_SubtreeOptionsSummarizeAtTheSameDepth(t *testing.T) {
+	fs := files.NewFSWithOptions(files.FSOptions{SummarizeBelow: 2})
+	for _, f := range []files.File{
+		{Path: "a", IsDir: true},
+		{Path: "a/b", IsDir: true},
+	} {
+		require.NoError(t, fs.Insert(f))
+	}
+
+	sub := files.NewFSWithOptions(fs.SubtreeOptions("a/b"))
+	require.NoError(t, sub.Insert(files.File{Path: "a/b", IsDir: true}))
+	require.NoError(t, sub.Insert(files.File{Path: "a/b/x", Size: 1}))
+	require.NoError(t, sub.Insert(files.File{Path: "a/b/c", IsDir: true}))
+	require.NoError(t, sub.Insert(files.File{Path: "a/b/c/y", Size: 1}))
+
+	_, ok := sub.Find("a/b/x")
+	assert.True(t, ok, "expected file at depth 2 to be kept")
+	_, ok = sub.Find("a/b/c/y")
+	assert.False(t, ok, "expected file at depth 3 to be summarized")
+}
+
+func childNames(t *testing.T, fs *files.FS, path string) []string {
+	t.Helper()
+	node, ok := fs.Find(path)
+	require.True(t, ok)
+	var names []string
+	for _, c := range node.Children() {
+		names = append(names, filepath.Base(c.File().Path))
+	}
+	return names
+}
+
+func Test_ChildrenAreSortedBySizeAsItChanges(t *testing.T) {
+	fs := files.NewFS()
+	for _, f := range []files.File{
+		{Path: "a", IsDir: true},
+		{Path: "a/x", IsDir: true},
+		{Path: "a/y", IsDir: true},
+		{Path: "a/z", DiskSize: 3},
+		{Path: "a/x/1", DiskSize: 2},
+	} {
+		require.NoError(t, fs.Insert(f))
+	}
+	assert.Equal(t, []string{"z", "x", "y"}, childNames(t, fs, "a"))
+
+	require.NoError(t, fs.Insert(files.File{Path: "a/y/1", DiskSize: 5}))
+	assert.Equal(t, []string{"y", "z", "x"}, childNames(t, fs, "a"))
+
+	require.NoError(t, fs.Update(files.File{Path: "a/z", DiskSize: 1}))
+	assert.Equal(t, []string{"y", "x", "z"}, childNames(t, fs, "a"))
+
+	require.NoError(t, fs.Remove("a/y/1"))
+	assert.Equal(t, []string{"x", "z", "y"}, childNames(t, fs, "a"))
+}
+
+func Test_SetOrderResortsChildren(t *testing.T) {
+	fs := files.NewFS()
+	now := time.Now()
+	for _, f := range []files.File{
+		{Path: "a", IsDir: true},
+		{Path: "a/b", DiskSize: 1, ModTime: now},
+		{Path: "a/c", DiskSize: 3, ModTime: now.Add(-time.Hour)},
+		{Path: "a/a", DiskSize: 2, ModTime: now.Add(-2 * time.Hour)},
+	} {
+		require.NoError(t, fs.Insert(f))
+	}
+	assert.Equal(t, []string{"c", "a", "b"}, childNames(t, fs, "a"))
+
+	version := fs.Version()
+	fs.SetOrder(files.Order{Key: files.SortByName})
+	assert.Equal(t, []string{"a", "b", "c"}, childNames(t, fs, "a"))
+	assert.NotEqual(t, version, fs.Version())
+
+	fs.SetOrder(files.Order{Key: files.SortByModTime})
+	assert.Equal(t, []string{"b", "c", "a"}, childNames(t, fs, "a"))
+
+	require.NoError(t, fs.Update(files.File{Path: "a/a", DiskSize: 2, ModTime: now.Add(time.Hour)}))
+	assert.Equal(t, []string{"a", "b", "c"}, childNames(t, fs, "a"))
+}
+
+func Test_RareFieldsAreKept(t *testing.T) {
+	modTime := time.Unix(1e9, 0)
+	want := []files.File{
+		{Path: "a", IsDir: true, Device: 1, Inode: 1, ModTime: modTime},
+		{Path: "a/same", Size: 1, Device: 1, Inode: 2, NumLinks: 1, UID: 7, GID: 8, HasOwner: true},
+		{Path: "a/link", Size: 2, Device: 1, Inode: 3, NumLinks: 2},
+		{Path: "a/symlink", IsSymlink: true, LinkTarget: "same", Device: 1},
+		{Path: "a/mnt", IsDir: true, Device: 2, Excluded: files.ExcludedOtherFS},
+	}
+	fs := newTestFS(t, want...)
+
+	for _, w := range want {
+		got := requireFile(t, fs, w.Path)
+		assert.Equal(t, w.Device, got.Device, w.Path)
+		assert.Equal(t, w.LinkTarget, got.LinkTarget, w.Path)
+		assert.Equal(t, w.GID, got.GID, w.Path)
+		assert.True(t, w.ModTime.Equal(got.ModTime), w.Path)
+	}
+	// only kept for hard links
+	link := requireFile(t, fs, "a/link")
+	assert.Equal(t, uint64(3), link.Inode)
+	assert.Equal(t, uint64(2), link.NumLinks)
+	assert.Zero(t, requireFile(t, fs, "a/same").Inode)
+}
+
+// benchmarkFiles returns the files of directories with filesPerDir files each,
+// with the metadata a walk would find
+func benchmarkFiles(filesPerDir int) []files.File {
+	const numFiles = 100_000
+	modTime := time.Unix(1e9, 0)
+	fileList := []files.File{{Path: "root", IsDir: true, Device: 1, Inode: 1, NumLinks: 1, ModTime: modTime}}
+	for d := 0; len(fileList) < numFiles; d++ {
+		dir := fmt.Sprintf("root/dir%d", d)
+		fileList = append(fileList, files.File{Path: dir, IsDir: true, DiskSize: 4096, Device: 1, Inode: uint64(len(fileList)), NumLinks: 2, ModTime: modTime, HasOwner: true})
+		for i := 0; i < filesPerDir; i++ {
+			fileList = append(fileList, files.File{
+				Path:     fmt.Sprintf("%s/file%d.txt", dir, i),
+				Size:     int64(i),
+				DiskSize: 4096,
+				Device:   1,
+				Inode:    uint64(len(fileList)),
+				NumLinks: 1,
+				ModTime:  modTime.Add(time.Duration(i) * time.Second),
+				UID:      1000,
+				GID:      1000,
+				HasOwner: true,
+			})
+		}
+	}
+	return fileList
+}
+
+// benchmarkFSMemory reports the heap used per file of an FS
+func benchmarkFSMemory(b *testing.B, filesPerDir int) {
+	fileList := benchmarkFiles(filesPerDir)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		fs := files.NewFS()
+		for _, f := range fileList {
+			if err := fs.Insert(f); err != nil {
+				b.Fatal(err)
+			}
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(len(fileList)), "heap-B/file")
+		runtime.KeepAlive(fs)
+	}
+}
+
+func BenchmarkFSMemory_Narrow(b *testing.B) { benchmarkFSMemory(b, 10) }
+
+func BenchmarkFSMemory_Wide(b *testing.B) { benchmarkFSMemory(b, 1000) }
+
+func BenchmarkFS_Insert(b *testing.B) {
+	fileList := benchmarkFiles(10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		fs := files.NewFS()
+		for _, f := range fileList {
+			if err := fs.Insert(f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package files
+
+import "sync"
+
+// Inodes are the inodes whose size walks have counted, and the path of the
+// link each is counted at. Walks that insert into the same FS, such as those
+// of a Watcher and rescans, share them through WalkOptions.Inodes, so that
+// every inode is counted once across them. They are safe for concurrent use.
+// A nil Inodes counts every link.
+type Inodes struct {
+	mu    sync.Mutex
+	paths map[inode]string
+	// others are the other links seen to each inode, which are not counted
+	others map[inode][]string
+}
+
+type inode struct {
+	device, inode uint64
+}
+
+func NewInodes() *Inodes {
+	return &Inodes{paths: make(map[inode]string), others: make(map[inode][]string)}
+}
+
+// count reports whether the size of the inode of f is to be counted at f,
+// which is the case if no other link to it is counted already. f is then
+// recorded as the link it is counted at, or as another link otherwise.
+func (s *Inodes) count(f File) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := inode{device: f.Device, inode: f.Inode}
+	if path, seen := s.paths[key]; seen && path != f.Path {
+		if !containsPath(s.others[key], f.Path) {
+			s.others[key] = append(s.others[key], f.Path)
+		}
+		return false
+	}
+	s.paths[key] = f.Path
+	s.others[key] = removePath(s.others[key], f.Path)
+	if len(s.others[key]) == 0 {
+		delete(s.others, key)
+	}
+	return true
+}
+
+// Forget forgets the links at or below path, which has been removed. It
+// returns a remaining link to each inode that was counted at a removed link,
+// to be counted instead.
+func (s *Inodes) Forget(path string) []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var remaining []string
+	for key, others := range s.others {
+		kept := others[:0]
+		for _, p := range others {
+			if !IsWithin(p, path) {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.others, key)
+		} else {
+			s.others[key] = kept
+		}
+	}
+	for key, p := range s.paths {
+		if !IsWithin(p, path) {
+			continue
+		}
+		delete(s.paths, key)
+		if others := s.others[key]; len(others) > 0 {
+			remaining = append(remaining, others[0])
+		}
+	}
+	return remaining
+}
+
+// Outside returns a copy of the inodes that are counted at links outside
+// path, to walk path again with
+func (s *Inodes) Outside(path string) *Inodes {
+	outside := NewInodes()
+	if s == nil {
+		return outside
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, p := range s.paths {
+		if !IsWithin(p, path) {
+			outside.paths[key] = p
+		}
+	}
+	for key, others := range s.others {
+		for _, p := range others {
+			if !IsWithin(p, path) {
+				outside.others[key] = append(outside.others[key], p)
+			}
+		}
+	}
+	return outside
+}
+
+// Replace replaces the links within path by those within path in other,
+// after walking path again, see Outside
+func (s *Inodes) Replace(path string, other *Inodes) {
+	if s == nil || other == nil || s == other {
+		return
+	}
+	other.mu.Lock()
+	within := make(map[inode]string)
+	for key, p := range other.paths {
+		if IsWithin(p, path) {
+			within[key] = p
+		}
+	}
+	othersWithin := make(map[inode][]string)
+	for key, others := range other.others {
+		for _, p := range others {
+			if IsWithin(p, path) {
+				othersWithin[key] = append(othersWithin[key], p)
+			}
+		}
+	}
+	other.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, p := range s.paths {
+		if IsWithin(p, path) {
+			delete(s.paths, key)
+		}
+	}
+	for key, p := range within {
+		s.paths[key] = p
+	}
+	for key, others := range s.others {
+		kept := others[:0]
+		for _, p := range others {
+			if !IsWithin(p, path) {
+				kept = append(kept, p)
+			}
+		}
+		s.others[key] = append(kept, othersWithin[key]...)
+		delete(othersWithin, key)
+		if len(s.others[key]) == 0 {
+			delete(s.others, key)
+		}
+	}
+	for key, others := range othersWithin {
+		s.others[key] = others
+	}
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// removePath returns paths without path
+func removePath(paths []string, path string) []string {
+	for i, p := range paths {
+		if p == path {
+			return append(paths[:i], paths[i+1:]...)
+		}
+	}
+	return paths
+}
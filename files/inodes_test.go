@@ -0,0 +1,28 @@
+package files
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInodes_ForgetReturnsRemainingLinks(t *testing.T) {
+	inodes := NewInodes()
+	link := func(path string, ino uint64) File {
+		return File{Path: path, Device: 1, Inode: ino, NumLinks: 3}
+	}
+	assert.True(t, inodes.count(link("/d/a", 1)))
+	assert.False(t, inodes.count(link("/d/b", 1)))
+	assert.False(t, inodes.count(link("/e/c", 1)))
+	assert.True(t, inodes.count(link("/e/x", 2)))
+	assert.False(t, inodes.count(link("/d/y", 2)))
+
+	remaining := inodes.Forget("/d")
+
+	// only the inode counted below /d needs counting again, and not at the
+	// other link removed along with it
+	assert.Equal(t, []string{"/e/c"}, remaining)
+	assert.True(t, inodes.count(link("/e/c", 1)))
+	assert.False(t, inodes.count(link("/e/x2", 1)))
+	assert.Empty(t, inodes.Forget("/e/x2"))
+}
@@ -0,0 +1,448 @@
+package files
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/jensgreen/dux/cancellable"
+)
+
+// ncduMajorVersion is the major version of the ncdu JSON export format, see
+// https://dev.yorhel.nl/ncdu/jsonfmt
+const ncduMajorVersion = 1
+
+// ncduEntry is the information ncdu exports about a file or directory
+type ncduEntry struct {
+	Name   string `json:"name"`
+	Asize  int64  `json:"asize,omitempty"`
+	Dsize  int64  `json:"dsize,omitempty"`
+	Dev    uint64 `json:"dev,omitempty"`
+	HasDev bool   `json:"-"`
+	Ino    uint64 `json:"ino,omitempty"`
+	Nlink  uint64 `json:"nlink,omitempty"`
+	Hlnkc  bool   `json:"hlnkc,omitempty"`
+	// ReadError is set when a directory could not be read
+	ReadError bool   `json:"read_error,omitempty"`
+	Excluded  string `json:"excluded,omitempty"`
+	// NotReg is set on what is neither a regular file nor a directory
+	NotReg bool `json:"notreg,omitempty"`
+	// Mtime is in seconds since the epoch, and only in extended exports
+	Mtime int64 `json:"mtime,omitempty"`
+	// Uid and Gid are only in extended exports
+	Uid *uint32 `json:"uid,omitempty"`
+	Gid *uint32 `json:"gid,omitempty"`
+}
+
+// ImportNcdu reads an ncdu JSON export, as written by `ncdu -o`, from r, and
+// sends a FileEvent for each file in it, like a walk would. The export is
+// streamed, so that large exports need not fit in memory. fileEvents is closed
+// when done or when ctx is cancelled.
+func ImportNcdu(ctx context.Context, r io.Reader, fileEvents chan<- FileEvent) {
+	defer func() {
+		log.Println("Closing FileEvent channel")
+		close(fileEvents)
+	}()
+
+	imp := &ncduImporter{
+		ctx:        ctx,
+		dec:        json.NewDecoder(r),
+		fileEvents: fileEvents,
+		inodes:     make(map[inode]struct{}),
+	}
+	imp.dec.UseNumber()
+	err := imp.importExport()
+	if err != nil && ctx.Err() == nil {
+		err = fmt.Errorf("invalid ncdu export: %w", err)
+		_ = cancellable.Send(ctx, fileEvents, FileEvent{Error: err})
+	}
+}
+
+type ncduImporter struct {
+	ctx        context.Context
+	dec        *json.Decoder
+	fileEvents chan<- FileEvent
+	inodes     map[inode]struct{}
+}
+
+func (imp *ncduImporter) send(event FileEvent) error {
+	return cancellable.Send(imp.ctx, imp.fileEvents, event)
+}
+
+// importExport reads [majorver, minorver, {metadata}, [root directory]]
+func (imp *ncduImporter) importExport() error {
+	if err := imp.expectDelim('['); err != nil {
+		return err
+	}
+	major, err := imp.dec.Token()
+	if err != nil {
+		return err
+	}
+	if n, ok := major.(json.Number); !ok || n.String() != fmt.Sprint(ncduMajorVersion) {
+		return fmt.Errorf("unsupported format version %v", major)
+	}
+	// minor version and metadata
+	for i := 0; i < 2; i++ {
+		if err := imp.skipValue(); err != nil {
+			return err
+		}
+	}
+	if err := imp.expectDelim('['); err != nil {
+		return err
+	}
+	return imp.importDir("", 0)
+}
+
+// importDir reads a directory after its opening '[': its entry, followed by
+// its children, which are either entries of files or arrays of directories
+func (imp *ncduImporter) importDir(parent string, parentDev uint64) error {
+	if err := imp.expectDelim('{'); err != nil {
+		return err
+	}
+	entry, err := imp.readEntry()
+	if err != nil {
+		return err
+	}
+	f := imp.newFile(parent, parentDev, entry, true)
+	if err := imp.sendFile(f, entry); err != nil {
+		return err
+	}
+
+	for imp.dec.More() {
+		tok, err := imp.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('['):
+			err = imp.importDir(f.Path, f.Device)
+		case json.Delim('{'):
+			var child ncduEntry
+			child, err = imp.readEntry()
+			if err == nil {
+				err = imp.sendFile(imp.newFile(f.Path, f.Device, child, false), child)
+			}
+		default:
+			err = fmt.Errorf("unexpected %v in directory %q", tok, f.Path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return imp.expectDelim(']')
+}
+
+func (imp *ncduImporter) newFile(parent string, parentDev uint64, entry ncduEntry, isDir bool) File {
+	path := entry.Name
+	if parent != "" {
+		path = filepath.Join(parent, entry.Name)
+	}
+	f := File{
+		Path:     path,
+		Size:     entry.Asize,
+		DiskSize: entry.Dsize,
+		IsDir:    isDir,
+		Device:   parentDev,
+		Inode:    entry.Ino,
+		NumLinks: entry.Nlink,
+	}
+	if entry.Mtime != 0 {
+		f.ModTime = time.Unix(entry.Mtime, 0)
+	}
+	if entry.Uid != nil {
+		f.UID = *entry.Uid
+		f.HasOwner = true
+	}
+	if entry.Gid != nil {
+		f.GID = *entry.Gid
+	}
+	if entry.HasDev {
+		f.Device = entry.Dev
+	}
+	if entry.Hlnkc && f.NumLinks < 2 {
+		// older exports flag hard links without counting them
+		f.NumLinks = 2
+	}
+	switch entry.Excluded {
+	case "":
+	case "otherfs", "kernfs", "frmlnk":
+		f.Excluded = ExcludedOtherFS
+	default:
+		f.Excluded = ExcludedPattern
+	}
+	return f
+}
+
+func (imp *ncduImporter) sendFile(f File, entry ncduEntry) error {
+	if entry.Hlnkc && !f.IsDir {
+		// ncdu exports every link with the size of the inode
+		key := inode{device: f.Device, inode: f.Inode}
+		if _, seen := imp.inodes[key]; seen {
+			f.Size = 0
+			f.DiskSize = 0
+			f.IsDuplicateLink = true
+		}
+		imp.inodes[key] = struct{}{}
+	}
+	f.ReadError = entry.ReadError
+	err := imp.send(FileEvent{File: f})
+	if err == nil && entry.ReadError {
+		err = imp.send(FileEvent{Error: &fs.PathError{Op: "read", Path: f.Path, Err: errors.New("read error in ncdu export")}})
+	}
+	return err
+}
+
+// readEntry reads the fields of an entry after its opening '{'. Unknown
+// fields are skipped.
+func (imp *ncduImporter) readEntry() (ncduEntry, error) {
+	var entry ncduEntry
+	for imp.dec.More() {
+		tok, err := imp.dec.Token()
+		if err != nil {
+			return entry, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return entry, fmt.Errorf("unexpected %v in entry", tok)
+		}
+		switch key {
+		case "name":
+			err = imp.dec.Decode(&entry.Name)
+		case "asize":
+			err = imp.dec.Decode(&entry.Asize)
+		case "dsize":
+			err = imp.dec.Decode(&entry.Dsize)
+		case "dev":
+			err = imp.dec.Decode(&entry.Dev)
+			entry.HasDev = true
+		case "ino":
+			err = imp.dec.Decode(&entry.Ino)
+		case "nlink":
+			err = imp.dec.Decode(&entry.Nlink)
+		case "hlnkc":
+			err = imp.dec.Decode(&entry.Hlnkc)
+		case "read_error":
+			err = imp.dec.Decode(&entry.ReadError)
+		case "excluded":
+			err = imp.dec.Decode(&entry.Excluded)
+		case "mtime":
+			err = imp.dec.Decode(&entry.Mtime)
+		case "uid":
+			err = imp.dec.Decode(&entry.Uid)
+		case "gid":
+			err = imp.dec.Decode(&entry.Gid)
+		default:
+			err = imp.skipValue()
+		}
+		if err != nil {
+			return entry, fmt.Errorf("field %q: %w", key, err)
+		}
+	}
+	if err := imp.expectDelim('}'); err != nil {
+		return entry, err
+	}
+	if entry.Name == "" {
+		return entry, errors.New("entry without name")
+	}
+	return entry, nil
+}
+
+func (imp *ncduImporter) expectDelim(delim json.Delim) error {
+	tok, err := imp.dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return nil
+}
+
+func (imp *ncduImporter) skipValue() error {
+	var v json.RawMessage
+	return imp.dec.Decode(&v)
+}
+
+// ExportNcdu writes tree in the ncdu JSON export format, to be read with
+// `ncdu -f`. The synthetic total of several paths has no equivalent in the
+// format, so it cannot be exported, only the paths below it. The files
+// summarized in a directory, see FSOptions, are exported as a single entry
+// named after their number.
+func ExportNcdu(w io.Writer, tree *FileTree) error {
+	if tree.isTotal() {
+		return errors.New("cannot export several paths as one ncdu export")
+	}
+	bw := bufio.NewWriter(w)
+	exp := &ncduExporter{w: bw, linkSizes: linkSizes(tree)}
+	metadata, err := json.Marshal(map[string]any{
+		"progname":  "dux",
+		"timestamp": time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	exp.printf("[%d,%d,%s,\n", ncduMajorVersion, 2, metadata)
+	exp.exportDir(tree, tree.Path(), 0, true)
+	exp.printf("]\n")
+	if exp.err != nil {
+		return exp.err
+	}
+	return bw.Flush()
+}
+
+type ncduExporter struct {
+	w   *bufio.Writer
+	err error
+	// linkSizes are the sizes of the inodes that duplicate links in the
+	// exported tree are links to
+	linkSizes map[inode]weights
+}
+
+// linkSizes returns the sizes of the inodes of the duplicate links within
+// tree, as counted at other links to them, which may be outside tree
+func linkSizes(tree *FileTree) map[inode]weights {
+	duplicated := make(map[inode]bool)
+	var findDuplicates func(node *FileTree)
+	findDuplicates = func(node *FileTree) {
+		if node.file.IsDuplicateLink && !node.file.IsDir && node.extra != nil {
+			duplicated[inode{device: node.extra.device, inode: node.extra.inode}] = true
+		}
+		for _, c := range node.children {
+			findDuplicates(c)
+		}
+	}
+	findDuplicates(tree)
+	sizes := make(map[inode]weights)
+	if len(duplicated) == 0 {
+		return sizes
+	}
+
+	root := tree
+	for root.parent != nil {
+		root = root.parent
+	}
+	var findCounted func(node *FileTree)
+	findCounted = func(node *FileTree) {
+		if !node.file.IsDuplicateLink && node.extra != nil && node.extra.inode != 0 {
+			key := inode{device: node.extra.device, inode: node.extra.inode}
+			if duplicated[key] {
+				sizes[key] = weights{size: node.file.Size, diskSize: node.file.DiskSize}
+			}
+		}
+		for _, c := range node.children {
+			findCounted(c)
+		}
+	}
+	findCounted(root)
+	return sizes
+}
+
+func (exp *ncduExporter) printf(format string, args ...any) {
+	if exp.err == nil {
+		_, exp.err = fmt.Fprintf(exp.w, format, args...)
+	}
+}
+
+func (exp *ncduExporter) exportDir(dir *FileTree, name string, parentDev uint64, isRoot bool) {
+	exp.printf("[")
+	exp.exportEntry(dir, name, parentDev, isRoot)
+	for _, c := range dir.children {
+		exp.printf(",\n")
+		if c.file.IsDir && c.file.Excluded == NotExcluded {
+			exp.exportDir(c, filepath.Base(c.name), dir.device(), false)
+		} else {
+			exp.exportEntry(c, filepath.Base(c.name), dir.device(), false)
+		}
+	}
+	if dir.extra != nil && dir.extra.numSummarized > 0 {
+		exp.printf(",\n")
+		exp.exportSummarized(dir)
+	}
+	exp.printf("]")
+}
+
+// exportSummarized writes the files summarized in dir as a single entry
+func (exp *ncduExporter) exportSummarized(dir *FileTree) {
+	extra := dir.extra
+	entry := ncduEntry{
+		Name:  fmt.Sprintf("[%d summarized files]", extra.numSummarized),
+		Asize: extra.summarized.size,
+		Dsize: extra.summarized.diskSize,
+	}
+	if extra.summarizedModTime != 0 {
+		entry.Mtime = timeOf(extra.summarizedModTime).Unix()
+	}
+	exp.writeEntry(entry)
+}
+
+func (exp *ncduExporter) exportEntry(node *FileTree, name string, parentDev uint64, isRoot bool) {
+	f := node.fileAt(name)
+	entry := ncduEntry{
+		Name:      name,
+		Asize:     f.Size,
+		Dsize:     f.DiskSize,
+		Ino:       f.Inode,
+		ReadError: f.ReadError,
+		NotReg:    f.IsSymlink,
+	}
+	if !f.ModTime.IsZero() {
+		entry.Mtime = f.ModTime.Unix()
+	}
+	if f.HasOwner {
+		uid, gid := f.UID, f.GID
+		entry.Uid, entry.Gid = &uid, &gid
+	}
+	// sizes of directories are aggregated in the tree, but not in the
+	// export, where summarized files have an entry of their own
+	for _, c := range node.children {
+		entry.Asize -= c.file.Size
+		entry.Dsize -= c.file.DiskSize
+	}
+	if node.extra != nil {
+		entry.Asize -= node.extra.summarized.size
+		entry.Dsize -= node.extra.summarized.diskSize
+	}
+	if isRoot || f.Device != parentDev {
+		entry.Dev = f.Device
+	}
+	if !f.IsDir && (f.NumLinks > 1 || f.IsDuplicateLink) {
+		// ncdu expects every link to carry the size of the inode, and counts
+		// it once by the inode. Links to inodes of unknown size are not
+		// flagged, so that they do not hide the size of other links.
+		size, counted := weights{size: f.Size, diskSize: f.DiskSize}, true
+		if f.IsDuplicateLink {
+			size, counted = exp.linkSizes[inode{device: f.Device, inode: f.Inode}]
+		}
+		if counted {
+			entry.Asize, entry.Dsize = size.size, size.diskSize
+			entry.Hlnkc = true
+			if f.NumLinks > 1 {
+				entry.Nlink = f.NumLinks
+			}
+		}
+	}
+	switch f.Excluded {
+	case ExcludedOtherFS:
+		entry.Excluded = "otherfs"
+	case ExcludedPattern:
+		entry.Excluded = "pattern"
+	}
+	exp.writeEntry(entry)
+}
+
+func (exp *ncduExporter) writeEntry(entry ncduEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil && exp.err == nil {
+		exp.err = err
+	}
+	exp.printf("%s", data)
+}
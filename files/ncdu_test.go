@@ -0,0 +1,218 @@
+package files
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func importNcdu(t *testing.T, export string) []FileEvent {
+	t.Helper()
+	ch := make(chan FileEvent)
+	go ImportNcdu(context.Background(), strings.NewReader(export), ch)
+	var events []FileEvent
+	for event := range ch {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestImportNcdu(t *testing.T) {
+	export := `[1, 2, {"progname": "ncdu", "progver": "1.18", "timestamp": 1700000000},
+	[{"name": "/srv", "asize": 4096, "dsize": 4096, "dev": 42, "ino": 1},
+		{"name": "a", "asize": 10, "dsize": 4096, "ino": 2, "hlnkc": true, "nlink": 2, "mtime": 1},
+		[{"name": "sub", "asize": 4096, "dsize": 4096, "ino": 3, "read_error": true},
+			{"name": "b", "asize": 10, "dsize": 4096, "ino": 2, "hlnkc": true}
+		],
+		{"name": "mnt", "excluded": "otherfs"},
+		{"name": "tmp", "excluded": "pattern"},
+		[{"name": "other", "asize": 0, "dsize": 0, "dev": 7, "ino": 1}]
+	]]`
+
+	events := importNcdu(t, export)
+
+	expected := []FileEvent{
+		{File: File{Path: "/srv", Size: 4096, DiskSize: 4096, IsDir: true, Device: 42, Inode: 1}},
+		{File: File{Path: "/srv/a", Size: 10, DiskSize: 4096, Device: 42, Inode: 2, NumLinks: 2, ModTime: time.Unix(1, 0)}},
+		{File: File{Path: "/srv/sub", Size: 4096, DiskSize: 4096, IsDir: true, Device: 42, Inode: 3, ReadError: true}},
+		{File: File{Path: "/srv/sub/b", Device: 42, Inode: 2, NumLinks: 2, IsDuplicateLink: true}},
+		{File: File{Path: "/srv/mnt", Device: 42, Excluded: ExcludedOtherFS}},
+		{File: File{Path: "/srv/tmp", Device: 42, Excluded: ExcludedPattern}},
+		{File: File{Path: "/srv/other", IsDir: true, Device: 7, Inode: 1}},
+	}
+	var files []FileEvent
+	var errs []error
+	for _, event := range events {
+		if event.Error != nil {
+			errs = append(errs, event.Error)
+		} else {
+			files = append(files, event)
+		}
+	}
+	assert.Equal(t, expected, files)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "/srv/sub")
+}
+
+func TestImportNcdu_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		export string
+		errMsg string
+	}{
+		{"not json", "hello", "invalid ncdu export"},
+		{"other version", `[2, 0, {}, [{"name": "/"}]]`, "unsupported format version 2"},
+		{"truncated", `[1, 2, {}, [{"name": "/"}, {"name": "a"`, "invalid ncdu export"},
+		{"file without name", `[1, 2, {}, [{"name": "/"}, {"asize": 1}]]`, "entry without name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := importNcdu(t, tt.export)
+
+			require.NotEmpty(t, events)
+			assert.ErrorContains(t, events[len(events)-1].Error, tt.errMsg)
+		})
+	}
+}
+
+func TestExportNcdu_CanBeImported(t *testing.T) {
+	fs := NewFS()
+	for _, f := range []File{
+		{Path: "/srv", IsDir: true, DiskSize: 4096, Device: 42, Inode: 1},
+		{Path: "/srv/a", Size: 10, DiskSize: 4096, Device: 42, Inode: 2, NumLinks: 2, ModTime: time.Unix(1e9, 0)},
+		{Path: "/srv/sub", IsDir: true, DiskSize: 4096, Device: 42, Inode: 3, ReadError: true},
+		{Path: "/srv/sub/b \"quoted\"", Size: 3, DiskSize: 4096, Device: 42, Inode: 4},
+		{Path: "/srv/mnt", IsDir: true, Device: 7, Excluded: ExcludedOtherFS},
+		{Path: "/srv/tmp", Excluded: ExcludedPattern, Device: 42},
+		{Path: "/srv/l", IsSymlink: true, Size: 1, Device: 42, Inode: 5},
+	} {
+		require.NoError(t, fs.Insert(f))
+	}
+	root, _ := fs.Root()
+
+	var buf strings.Builder
+	require.NoError(t, ExportNcdu(&buf, root))
+	events := importNcdu(t, buf.String())
+
+	imported := NewFS()
+	for _, event := range events {
+		if event.Error == nil {
+			require.NoError(t, imported.Insert(event.File))
+		}
+	}
+	for _, path := range []string{"/srv", "/srv/sub", "/srv/mnt", "/srv/tmp"} {
+		want, _ := fs.Find(path)
+		got, ok := imported.Find(path)
+		require.True(t, ok, path)
+		assert.Equal(t, want.File().Size, got.File().Size, path)
+		assert.Equal(t, want.File().DiskSize, got.File().DiskSize, path)
+		assert.Equal(t, want.File().NumDescendants, got.File().NumDescendants, path)
+		assert.Equal(t, want.File().Excluded, got.File().Excluded, path)
+		assert.Equal(t, want.File().ReadError, got.File().ReadError, path)
+	}
+	link, _ := imported.Find("/srv/a")
+	assert.Equal(t, uint64(2), link.File().NumLinks)
+	root, _ = imported.Root()
+	assert.Equal(t, time.Unix(1e9, 0), root.File().NewestModTime)
+}
+
+func TestExportNcdu_RejectsTotal(t *testing.T) {
+	fs := NewFS()
+	require.NoError(t, fs.Insert(File{Path: TotalPath, IsDir: true}))
+	root, _ := fs.Root()
+
+	assert.Error(t, ExportNcdu(io.Discard, root))
+}
+
+// roundTripNcdu exports the root of fs and imports it into a new FS
+func roundTripNcdu(t *testing.T, fs *FS) *FS {
+	t.Helper()
+	root, ok := fs.Root()
+	require.True(t, ok)
+	var buf strings.Builder
+	require.NoError(t, ExportNcdu(&buf, root))
+	imported := NewFS()
+	for _, event := range importNcdu(t, buf.String()) {
+		require.NoError(t, event.Error)
+		require.NoError(t, imported.Insert(event.File))
+	}
+	return imported
+}
+
+func TestExportNcdu_HardLinksKeepTheirSize(t *testing.T) {
+	ch := make(chan FileEvent)
+	go func() {
+		defer close(ch)
+		for _, f := range []File{
+			{Path: "/srv", IsDir: true, Device: 42, Inode: 1},
+			{Path: "/srv/a", IsDir: true, Device: 42, Inode: 2},
+			{Path: "/srv/a/x", Size: 100, DiskSize: 4096, Device: 42, Inode: 3, NumLinks: 2},
+			{Path: "/srv/b", IsDir: true, Device: 42, Inode: 4},
+			{Path: "/srv/b/y", Device: 42, Inode: 3, NumLinks: 2, IsDuplicateLink: true},
+			// exported first, as the largest
+			{Path: "/srv/b/z", Size: 1000, DiskSize: 8192, Device: 42, Inode: 5, NumLinks: 1},
+		} {
+			ch <- FileEvent{File: f}
+		}
+	}()
+	fs := NewFS()
+	for event := range ch {
+		require.NoError(t, fs.Insert(event.File))
+	}
+
+	imported := roundTripNcdu(t, fs)
+
+	// either link may carry the size after importing
+	want, _ := fs.Find("/srv")
+	got, ok := imported.Find("/srv")
+	require.True(t, ok)
+	assert.Equal(t, want.File().Size, got.File().Size)
+	assert.Equal(t, want.File().DiskSize, got.File().DiskSize)
+	x, _ := imported.Find("/srv/a/x")
+	linked, _ := imported.Find("/srv/b/y")
+	assert.Equal(t, int64(100), x.File().Size+linked.File().Size)
+	assert.NotEqual(t, x.File().IsDuplicateLink, linked.File().IsDuplicateLink)
+
+	// exporting only the directory of the link that was not counted
+	b, _ := fs.Find("/srv/b")
+	var buf strings.Builder
+	require.NoError(t, ExportNcdu(&buf, b))
+	events := importNcdu(t, buf.String())
+	require.Len(t, events, 3)
+	y := events[2].File
+	assert.Equal(t, "/srv/b/y", y.Path)
+	assert.Equal(t, int64(100), y.Size, "the inode is in the exported directory")
+	assert.False(t, y.IsDuplicateLink)
+}
+
+func TestExportNcdu_SummarizedFilesAreCounted(t *testing.T) {
+	modTime := time.Unix(1e9, 0)
+	fs := NewFSWithOptions(FSOptions{SummarizeBelow: 1})
+	for _, f := range []File{
+		{Path: "/srv", IsDir: true, DiskSize: 4096},
+		{Path: "/srv/a", IsDir: true, DiskSize: 4096},
+		{Path: "/srv/a/x", Size: 10, DiskSize: 4096, ModTime: modTime},
+		{Path: "/srv/a/y", Size: 20, DiskSize: 4096, Device: 42, Inode: 3, NumLinks: 2},
+	} {
+		require.NoError(t, fs.Insert(f))
+	}
+
+	imported := roundTripNcdu(t, fs)
+
+	for _, path := range []string{"/srv", "/srv/a"} {
+		want, _ := fs.Find(path)
+		got, ok := imported.Find(path)
+		require.True(t, ok, path)
+		assert.Equal(t, want.File().Size, got.File().Size, path)
+		assert.Equal(t, want.File().DiskSize, got.File().DiskSize, path)
+		assert.Equal(t, want.File().NewestModTime, got.File().NewestModTime, path)
+	}
+	summarized, ok := imported.Find("/srv/a/[2 summarized files]")
+	require.True(t, ok)
+	assert.Equal(t, int64(30), summarized.File().Size)
+}
@@ -0,0 +1,165 @@
+package files
+
+import "sort"
+
+// SortKey selects what the children of each directory are ordered by
+type SortKey int
+
+const (
+	// SortBySize puts the largest first
+	SortBySize SortKey = iota
+	// SortByName puts children in alphabetical order
+	SortByName
+	// SortByModTime puts the most recently modified first, by NewestModTime
+	SortByModTime
+	NumSortKeys
+)
+
+func (k SortKey) String() string {
+	switch k {
+	case SortByName:
+		return "name"
+	case SortByModTime:
+		return "mtime"
+	}
+	return "size"
+}
+
+// ParseSortKey returns the SortKey named s, as by String
+func ParseSortKey(s string) (SortKey, bool) {
+	for k := SortKey(0); k < NumSortKeys; k++ {
+		if k.String() == s {
+			return k, true
+		}
+	}
+	return SortBySize, false
+}
+
+// Order is the order that an FS keeps the children of each directory in
+type Order struct {
+	Key SortKey
+	// SizeMode is the size compared by SortBySize
+	SizeMode SizeMode
+}
+
+// less reports whether a goes before b among siblings
+func (o Order) less(a *FileTree, b *FileTree) bool {
+	return o.lessKey(o.keyOf(a), o.keyOf(b))
+}
+
+// sortKey is what an Order compares of a node, kept to find the node by after
+// it has changed
+type sortKey struct {
+	name string
+	// value is the size or time compared, depending on the Order
+	value int64
+}
+
+func (o Order) keyOf(ft *FileTree) sortKey {
+	key := sortKey{name: ft.name}
+	switch o.Key {
+	case SortBySize:
+		key.value = ft.file.SizeOf(o.SizeMode)
+	case SortByModTime:
+		key.value = ft.file.NewestModTime
+	}
+	return key
+}
+
+// lessKey reports whether a goes first, the largest or newest value first.
+// Ties are broken by name, so that siblings, whose names differ, are always in
+// the same order.
+func (o Order) lessKey(a sortKey, b sortKey) bool {
+	if a.value != b.value {
+		return a.value > b.value
+	}
+	return a.name < b.name
+}
+
+// Order returns the order of the children of each directory
+func (fs *FS) Order() Order {
+	return fs.opts.Order
+}
+
+// SetOrder sorts the children of each directory by order, and keeps them in
+// it from now on
+func (fs *FS) SetOrder(order Order) {
+	if order == fs.opts.Order {
+		return
+	}
+	fs.version++
+	fs.opts.Order = order
+	if fs.root != nil {
+		fs.sortTree(fs.root)
+	}
+}
+
+// sortTree sorts the children of ft and its descendants
+func (fs *FS) sortTree(ft *FileTree) {
+	fs.sortChildren(ft)
+	for _, c := range ft.children {
+		fs.sortTree(c)
+	}
+}
+
+// sortChildren sorts the children of ft, unless already sorted
+func (fs *FS) sortChildren(ft *FileTree) {
+	less := func(i, j int) bool {
+		return fs.opts.Order.less(ft.children[i], ft.children[j])
+	}
+	if !sort.SliceIsSorted(ft.children, less) {
+		sort.Slice(ft.children, less)
+	}
+}
+
+// insertChild adds child to the children of ft, in order
+func (fs *FS) insertChild(ft *FileTree, child *FileTree) {
+	i := sort.Search(len(ft.children), func(i int) bool {
+		return fs.opts.Order.less(child, ft.children[i])
+	})
+	ft.addChild(child)
+	copy(ft.children[i+1:], ft.children[i:])
+	ft.children[i] = child
+}
+
+// reposition moves ft among its siblings after it has changed, given what it
+// was ordered by before
+func (fs *FS) reposition(ft *FileTree, old sortKey) {
+	parent := ft.parent
+	if parent == nil {
+		return
+	}
+	order := fs.opts.Order
+	if order.keyOf(ft) == old {
+		return
+	}
+	siblings := parent.children
+	// ft is still where its old key belongs
+	i := sort.Search(len(siblings), func(i int) bool {
+		return siblings[i] == ft || !order.lessKey(order.keyOf(siblings[i]), old)
+	})
+	if i == len(siblings) || siblings[i] != ft {
+		// not where it was expected, which should not happen
+		for i = range siblings {
+			if siblings[i] == ft {
+				break
+			}
+		}
+	}
+
+	switch {
+	case i > 0 && order.less(ft, siblings[i-1]):
+		j := sort.Search(i, func(j int) bool {
+			return order.less(ft, siblings[j])
+		})
+		copy(siblings[j+1:i+1], siblings[j:i])
+		siblings[j] = ft
+	case i < len(siblings)-1 && order.less(siblings[i+1], ft):
+		after := siblings[i+1:]
+		j := i + sort.Search(len(after), func(j int) bool {
+			return order.less(ft, after[j])
+		})
+		copy(siblings[i:j], siblings[i+1:j+1])
+		siblings[j] = ft
+	}
+}
@@ -0,0 +1,102 @@
+package files
+
+import "sort"
+
+// OwnerUsage is what a user owns within a directory, the directory included
+type OwnerUsage struct {
+	UID      uint32
+	Size     int64
+	DiskSize int64
+	NumFiles int
+}
+
+// SizeOf returns the apparent size or the disk usage owned
+func (u OwnerUsage) SizeOf(mode SizeMode) int64 {
+	if mode == ApparentSize {
+		return u.Size
+	}
+	return u.DiskSize
+}
+
+// ownerTotals are the OwnerUsage of each user within a directory
+type ownerTotals map[uint32]OwnerUsage
+
+// Owners returns what each user owns within ft, by disk usage in descending
+// order. Files without a known owner are not included.
+func (ft *FileTree) Owners() []OwnerUsage {
+	owners := ownersOf(ft)
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].DiskSize != owners[j].DiskSize {
+			return owners[i].DiskSize > owners[j].DiskSize
+		}
+		return owners[i].UID < owners[j].UID
+	})
+	return owners
+}
+
+// ownersOf returns what node adds to the owner totals of its ancestors
+func ownersOf(node *FileTree) []OwnerUsage {
+	if f := node.file; !f.IsDir {
+		return ownUsage(File{Size: f.Size, DiskSize: f.DiskSize, UID: f.UID, HasOwner: f.HasOwner})
+	}
+	owners := make([]OwnerUsage, 0, len(node.owners))
+	for _, u := range node.owners {
+		owners = append(owners, u)
+	}
+	return owners
+}
+
+// ownUsage returns what f owns by itself, given its sizes without contents
+func ownUsage(f File) []OwnerUsage {
+	if !f.HasOwner {
+		return nil
+	}
+	return []OwnerUsage{{UID: f.UID, Size: f.Size, DiskSize: f.DiskSize, NumFiles: 1}}
+}
+
+// adjustOwners adds, or subtracts if negative, the usage in delta to the owner
+// totals of ft, if a directory, and all its ancestors
+func (ft *FileTree) adjustOwners(delta []OwnerUsage, negative bool) {
+	if len(delta) == 0 {
+		return
+	}
+	for node, ok := ft, true; ok; node, ok = node.Parent() {
+		if !node.file.IsDir {
+			continue
+		}
+		if node.owners == nil {
+			node.owners = make(ownerTotals, len(delta))
+		}
+		for _, d := range delta {
+			u := node.owners[d.UID]
+			u.UID = d.UID
+			if negative {
+				u.Size -= d.Size
+				u.DiskSize -= d.DiskSize
+				u.NumFiles -= d.NumFiles
+			} else {
+				u.Size += d.Size
+				u.DiskSize += d.DiskSize
+				u.NumFiles += d.NumFiles
+			}
+			if u.NumFiles <= 0 {
+				delete(node.owners, d.UID)
+			} else {
+				node.owners[d.UID] = u
+			}
+		}
+		node.file.MainUID = node.owners.main(node.file.UID)
+	}
+}
+
+// main returns the user owning the most disk usage, or fallback if none
+func (totals ownerTotals) main(fallback uint32) uint32 {
+	uid, found := fallback, false
+	var most int64
+	for _, u := range totals {
+		if !found || u.DiskSize > most || (u.DiskSize == most && u.UID < uid) {
+			uid, most, found = u.UID, u.DiskSize, true
+		}
+	}
+	return uid
+}
@@ -0,0 +1,144 @@
+package files
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+)
+
+// Patterns is a list of gitignore-style glob patterns, matched against paths
+// relative to the root of a walk. See gitignore(5) for the semantics.
+type Patterns struct {
+	rules []rule
+}
+
+type rule struct {
+	// base is the directory the rule is relative to, "" for the walk root
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	// anchored rules match the whole path below base, other rules match
+	// the name at any depth
+	anchored bool
+}
+
+// Add adds a single pattern relative to base. Blank lines and comments are
+// ignored.
+func (p *Patterns) Add(pattern string, base string) {
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return
+	}
+
+	r := rule{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\`) {
+		// "\#" and "\!" are literal
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	r.anchored = strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return
+	}
+	r.segments = strings.Split(pattern, "/")
+	p.rules = append(p.rules, r)
+}
+
+// AddFrom adds one pattern per line read from r, relative to base
+func (p *Patterns) AddFrom(r io.Reader, base string) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.Add(scanner.Text(), base)
+	}
+	return scanner.Err()
+}
+
+// Len returns the number of patterns
+func (p *Patterns) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.rules)
+}
+
+// Match reports whether the slash-separated path, relative to the walk root,
+// is excluded. The last matching pattern decides, so that a negated pattern
+// can re-include what an earlier pattern excluded.
+func (p *Patterns) Match(relPath string, isDir bool) bool {
+	if p == nil {
+		return false
+	}
+	excluded := false
+	for _, r := range p.rules {
+		if r.match(relPath, isDir) {
+			excluded = !r.negate
+		}
+	}
+	return excluded
+}
+
+// with returns a copy of p extended with the patterns of other, leaving p
+// untouched so that it can be shared by sibling directories
+func (p *Patterns) with(other *Patterns) *Patterns {
+	if other.Len() == 0 {
+		return p
+	}
+	rules := make([]rule, 0, p.Len()+other.Len())
+	if p != nil {
+		rules = append(rules, p.rules...)
+	}
+	rules = append(rules, other.rules...)
+	return &Patterns{rules: rules}
+}
+
+func (r rule) match(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		relPath = relPath[len(r.base)+1:]
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.segments[0], path.Base(relPath))
+		return ok
+	}
+	return matchSegments(r.segments, strings.Split(relPath, "/"))
+}
+
+func matchSegments(pattern []string, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				// a trailing "**" matches everything inside
+				return len(segments) > 0
+			}
+			// "**" matches zero or more directories
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
@@ -0,0 +1,63 @@
+package files
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatterns_Match(t *testing.T) {
+	tests := []struct {
+		patterns string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{"node_modules", "node_modules", true, true},
+		{"node_modules", "a/b/node_modules", true, true},
+		{"*.o", "src/main.o", false, true},
+		{"*.o", "src/main.c", false, false},
+		{"cache/", "cache", true, true},
+		{"cache/", "cache", false, false},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"docs/*.md", "docs/a.md", false, true},
+		{"docs/*.md", "docs/sub/a.md", false, false},
+		{"**/logs", "a/b/logs", true, true},
+		{"**/logs", "logs", true, true},
+		{"a/**/z", "a/z", true, true},
+		{"a/**/z", "a/b/c/z", true, true},
+		{"a/**", "a", true, false},
+		{"a/**", "a/b", false, true},
+		{"*.log\n!keep.log", "keep.log", false, false},
+		{"*.log\n!keep.log", "drop.log", false, true},
+		{"# comment\n\n", "# comment", false, false},
+		{`\#hash`, "#hash", false, true},
+	}
+
+	for _, tt := range tests {
+		p := &Patterns{}
+		require.NoError(t, p.AddFrom(strings.NewReader(tt.patterns), ""))
+		got := p.Match(tt.path, tt.isDir)
+		assert.Equalf(t, tt.want, got, "patterns %q, path %q, isDir %v", tt.patterns, tt.path, tt.isDir)
+	}
+}
+
+func TestPatterns_MatchRelativeToBase(t *testing.T) {
+	p := &Patterns{}
+	p.Add("/out", "sub")
+	p.Add("*.tmp", "sub")
+
+	assert.True(t, p.Match("sub/out", true))
+	assert.False(t, p.Match("out", true))
+	assert.False(t, p.Match("sub/deeper/out", true))
+	assert.True(t, p.Match("sub/deeper/x.tmp", false))
+	assert.False(t, p.Match("x.tmp", false))
+}
+
+func TestPatterns_NilMatchesNothing(t *testing.T) {
+	var p *Patterns
+	assert.False(t, p.Match("foo", false))
+}
@@ -0,0 +1,119 @@
+package files
+
+import (
+	"sync"
+	"time"
+)
+
+// Progress counts what a walk has read so far, to show how it is going. It is
+// safe for concurrent use by the workers of a walk. A nil Progress counts
+// nothing.
+type Progress struct {
+	mu       sync.Mutex
+	start    time.Time
+	dirs     int
+	files    int
+	bytes    int64
+	current  string
+	expected int64
+}
+
+// NewProgress returns a Progress of a walk starting now
+func NewProgress() *Progress {
+	return &Progress{start: time.Now()}
+}
+
+// SetExpected sets the disk usage the walk is expected to find in total, to
+// estimate how much of it is done
+func (p *Progress) SetExpected(diskSize int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expected = diskSize
+}
+
+// visitDir counts the directory at path as being read
+func (p *Progress) visitDir(path string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dirs++
+	p.current = path
+}
+
+// addFile counts f as found
+func (p *Progress) addFile(f File) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files++
+	p.bytes += f.DiskSize
+}
+
+// Stats returns what has been counted so far
+func (p *Progress) Stats() ProgressStats {
+	if p == nil {
+		return ProgressStats{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ProgressStats{
+		Dirs:       p.dirs,
+		Files:      p.files,
+		DiskSize:   p.bytes,
+		Elapsed:    time.Since(p.start),
+		CurrentDir: p.current,
+		Expected:   p.expected,
+	}
+}
+
+// ProgressStats are the counts of a Progress at one point in time
+type ProgressStats struct {
+	// Dirs is the number of directories read, or being read
+	Dirs int
+	// Files is the number of files, directories included, found
+	Files int
+	// DiskSize is the disk usage of the files found
+	DiskSize int64
+	Elapsed  time.Duration
+	// CurrentDir is the directory read most recently
+	CurrentDir string
+	// Expected is the disk usage expected in total, or 0 if unknown
+	Expected int64
+}
+
+// FilesPerSec returns the average number of files found per second
+func (s ProgressStats) FilesPerSec() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Files) / s.Elapsed.Seconds()
+}
+
+// BytesPerSec returns the average disk usage found per second
+func (s ProgressStats) BytesPerSec() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.DiskSize) / s.Elapsed.Seconds()
+}
+
+// Percent returns an estimate of how much of the walk is done, from what was
+// expected. The estimate stays below 100 until the walk is done, as the
+// expectation may be off.
+func (s ProgressStats) Percent() (int, bool) {
+	if s.Expected <= 0 {
+		return 0, false
+	}
+	percent := int(s.DiskSize * 100 / s.Expected)
+	if percent > 99 {
+		percent = 99
+	}
+	return percent, true
+}
@@ -0,0 +1,57 @@
+package files
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalk_CountsProgress(t *testing.T) {
+	ch := make(chan FileEvent, 10)
+	progress := NewProgress()
+	progress.SetExpected(1 << 40)
+
+	Walk(context.Background(), "../testdata/example", ch, WalkOptions{Progress: progress})
+	var diskSize int64
+	for event := range ch {
+		diskSize += event.File.DiskSize
+	}
+
+	stats := progress.Stats()
+	assert.Equal(t, 3, stats.Dirs)
+	assert.Equal(t, 7, stats.Files)
+	assert.Equal(t, diskSize, stats.DiskSize)
+	assert.NotEmpty(t, stats.CurrentDir)
+	assert.Equal(t, int64(1<<40), stats.Expected)
+}
+
+func TestProgressStats_Rates(t *testing.T) {
+	stats := ProgressStats{Files: 30, DiskSize: 3000, Elapsed: 3 * time.Second}
+
+	assert.Equal(t, 10.0, stats.FilesPerSec())
+	assert.Equal(t, 1000.0, stats.BytesPerSec())
+	assert.Zero(t, ProgressStats{Files: 1}.FilesPerSec())
+}
+
+func TestProgressStats_PercentStaysBelowDone(t *testing.T) {
+	_, ok := ProgressStats{DiskSize: 10}.Percent()
+	assert.False(t, ok, "nothing expected")
+
+	percent, ok := ProgressStats{DiskSize: 25, Expected: 100}.Percent()
+	assert.True(t, ok)
+	assert.Equal(t, 25, percent)
+
+	percent, _ = ProgressStats{DiskSize: 150, Expected: 100}.Percent()
+	assert.Equal(t, 99, percent)
+}
+
+func TestFilesystemUsage_OnlyOfMountPoints(t *testing.T) {
+	_, ok := FilesystemUsage([]string{"../testdata/example"})
+	assert.False(t, ok, "not a mount point")
+
+	used, ok := FilesystemUsage([]string{"/"})
+	assert.True(t, ok)
+	assert.Positive(t, used)
+}
@@ -0,0 +1,321 @@
+package files
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/jensgreen/dux/cancellable"
+)
+
+// SnapshotVersion is the version of the snapshot format written by
+// RecordSnapshot. Snapshots of this and earlier versions can be loaded.
+const SnapshotVersion = 1
+
+const snapshotMagic = "dux snapshot"
+
+// A snapshot is a gzipped gob stream of a snapshotHeader followed by one
+// snapshotEntry per FileEvent of the recorded walk, in the order they were
+// sent, and a trailing snapshotEntry if the walk completed. Fields may only be
+// added to these types, so that gob can still decode
+// older snapshots.
+type snapshotHeader struct {
+	Magic    string
+	Version  int
+	ScanTime time.Time
+}
+
+type snapshotEntry struct {
+	// Parent is the index of the entry of the parent directory, or -1 if the
+	// parent is not in the snapshot, in which case Name is the full path
+	Parent int
+	Name   string
+	// Error is set on entries recording an error rather than a file. Errors
+	// about a path have the path and operation stored separately.
+	Error           string
+	ErrorOp         string
+	ErrorPath       string
+	Size            int64
+	DiskSize        int64
+	IsDir           bool
+	Device          uint64
+	Inode           uint64
+	NumLinks        uint64
+	IsDuplicateLink bool
+	IsSymlink       bool
+	LinkTarget      string
+	Excluded        Exclusion
+	ReadError       bool
+	IsArchive       bool
+	ModTime         time.Time
+	UID             uint32
+	GID             uint32
+	HasOwner        bool
+	// End is set on the trailer of a complete snapshot, which records
+	// nothing else
+	End bool
+}
+
+// ErrIncompleteSnapshot is sent by Snapshot.Load when a snapshot ends before
+// the walk it recorded did, e.g. as the walk was cancelled
+var ErrIncompleteSnapshot = errors.New("incomplete snapshot: the scan it was saved from did not complete")
+
+// RecordSnapshot forwards the FileEvents of a walk from in to out, and writes
+// them as a snapshot to w, to be loaded with OpenSnapshot. out is closed when
+// in is closed or ctx is cancelled. Errors writing the snapshot are sent to
+// out as FileEvents. When cancelled, what was walked so far is kept, but the
+// snapshot is loaded as incomplete, see ErrIncompleteSnapshot.
+func RecordSnapshot(ctx context.Context, w io.Writer, in <-chan FileEvent, out chan<- FileEvent) {
+	defer func() {
+		log.Println("Closing snapshot FileEvent channel")
+		close(out)
+	}()
+
+	rec := &recorder{
+		gz:      gzip.NewWriter(w),
+		indices: make(map[string]int),
+	}
+	rec.enc = gob.NewEncoder(rec.gz)
+	rec.write(snapshotHeader{Magic: snapshotMagic, Version: SnapshotVersion, ScanTime: time.Now()})
+
+	for {
+		event, err := cancellable.Receive(ctx, in)
+		if errors.Is(err, cancellable.ErrClosed) {
+			break
+		} else if err != nil {
+			// keep what was walked so far
+			_ = rec.close()
+			return
+		}
+		rec.record(event)
+		err = cancellable.Send(ctx, out, event)
+		if err != nil {
+			_ = rec.close()
+			return
+		}
+	}
+	rec.write(snapshotEntry{Parent: -1, End: true})
+	if err := rec.close(); err != nil {
+		err = fmt.Errorf("cannot save snapshot: %w", err)
+		_ = cancellable.Send(ctx, out, FileEvent{Error: err})
+	}
+}
+
+type recorder struct {
+	gz      *gzip.Writer
+	enc     *gob.Encoder
+	indices map[string]int
+	n       int
+	err     error
+}
+
+func (rec *recorder) write(v any) {
+	if rec.err == nil {
+		rec.err = rec.enc.Encode(v)
+	}
+}
+
+func (rec *recorder) record(event FileEvent) {
+	if event.Error != nil {
+		entry := snapshotEntry{Parent: -1, Error: event.Error.Error()}
+		var perr *fs.PathError
+		if errors.As(event.Error, &perr) {
+			entry.Error, entry.ErrorOp, entry.ErrorPath = perr.Err.Error(), perr.Op, perr.Path
+		}
+		rec.write(entry)
+		rec.n++
+		return
+	}
+	f := event.File
+	entry := snapshotEntry{
+		Parent:          -1,
+		Name:            f.Path,
+		Size:            f.Size,
+		DiskSize:        f.DiskSize,
+		IsDir:           f.IsDir,
+		Device:          f.Device,
+		Inode:           f.Inode,
+		NumLinks:        f.NumLinks,
+		IsDuplicateLink: f.IsDuplicateLink,
+		IsSymlink:       f.IsSymlink,
+		LinkTarget:      f.LinkTarget,
+		Excluded:        f.Excluded,
+		ReadError:       f.ReadError,
+		IsArchive:       f.IsArchive,
+		ModTime:         f.ModTime,
+		UID:             f.UID,
+		GID:             f.GID,
+		HasOwner:        f.HasOwner,
+	}
+	if parent, ok := rec.indices[f.Dir()]; ok && !f.IsTotal() && f.Dir() != f.Path {
+		entry.Parent = parent
+		entry.Name = f.Name()
+	}
+	if f.IsDir {
+		rec.indices[f.Path] = rec.n
+	}
+	rec.write(entry)
+	rec.n++
+}
+
+// close completes the snapshot, and returns the first error writing it
+func (rec *recorder) close() error {
+	if err := rec.gz.Close(); rec.err == nil {
+		rec.err = err
+	}
+	return rec.err
+}
+
+// Snapshot is an opened snapshot, ready to be loaded
+type Snapshot struct {
+	// ScanTime is when the snapshotted walk started
+	ScanTime time.Time
+	Version  int
+
+	dec *gob.Decoder
+}
+
+// OpenSnapshot reads the header of a snapshot written by RecordSnapshot
+func OpenSnapshot(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.New("not a dux snapshot")
+	}
+	dec := gob.NewDecoder(gz)
+	var header snapshotHeader
+	err = dec.Decode(&header)
+	if err != nil || header.Magic != snapshotMagic {
+		return nil, errors.New("not a dux snapshot")
+	}
+	if header.Version > SnapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d is newer than supported version %d", header.Version, SnapshotVersion)
+	}
+	return &Snapshot{ScanTime: header.ScanTime, Version: header.Version, dec: dec}, nil
+}
+
+// DiskUsage reads the rest of the snapshot, and returns the disk usage of the
+// files in it. It reports false unless the snapshot is of a complete walk of
+// paths, as the usage of other paths, or of part of them, says little about
+// these. The snapshot cannot be loaded afterwards.
+func (s *Snapshot) DiskUsage(paths []string) (int64, bool) {
+	want := make(map[string]bool)
+	for _, path := range uniqueRoots(paths) {
+		want[path] = true
+	}
+	var used int64
+	roots := make(map[string]bool)
+	for {
+		entry, err := s.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, false
+		}
+		if entry.Error != "" {
+			continue
+		}
+		if entry.Parent < 0 && entry.Name != TotalPath {
+			if !want[entry.Name] {
+				return 0, false
+			}
+			roots[entry.Name] = true
+		}
+		used += entry.DiskSize
+	}
+	return used, len(roots) == len(want)
+}
+
+// Load sends the FileEvents recorded in the snapshot, as if walking again.
+// fileEvents is closed when done or when ctx is cancelled.
+func (s *Snapshot) Load(ctx context.Context, fileEvents chan<- FileEvent) {
+	defer func() {
+		log.Println("Closing FileEvent channel")
+		close(fileEvents)
+	}()
+
+	var paths []string
+	for {
+		entry, err := s.next()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if errors.Is(err, ErrIncompleteSnapshot) {
+			_ = cancellable.Send(ctx, fileEvents, FileEvent{Error: err})
+			return
+		}
+		if err != nil {
+			err = fmt.Errorf("corrupt snapshot: %w", err)
+			_ = cancellable.Send(ctx, fileEvents, FileEvent{Error: err})
+			return
+		}
+
+		var event FileEvent
+		if entry.ErrorPath != "" {
+			event.Error = &fs.PathError{Op: entry.ErrorOp, Path: entry.ErrorPath, Err: errors.New(entry.Error)}
+		} else if entry.Error != "" {
+			event.Error = errors.New(entry.Error)
+		} else {
+			event.File = File{
+				Path:            entry.Name,
+				Size:            entry.Size,
+				DiskSize:        entry.DiskSize,
+				IsDir:           entry.IsDir,
+				Device:          entry.Device,
+				Inode:           entry.Inode,
+				NumLinks:        entry.NumLinks,
+				IsDuplicateLink: entry.IsDuplicateLink,
+				IsSymlink:       entry.IsSymlink,
+				LinkTarget:      entry.LinkTarget,
+				Excluded:        entry.Excluded,
+				ReadError:       entry.ReadError,
+				IsArchive:       entry.IsArchive,
+				ModTime:         entry.ModTime,
+				UID:             entry.UID,
+				GID:             entry.GID,
+				HasOwner:        entry.HasOwner,
+			}
+			if entry.Parent >= 0 && entry.Parent < len(paths) {
+				event.File.Path = filepath.Join(paths[entry.Parent], entry.Name)
+			}
+		}
+		// entries are indexed in order, errors included
+		paths = append(paths, event.File.Path)
+
+		err = cancellable.Send(ctx, fileEvents, event)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// next returns the next entry of the snapshot, or io.EOF after the last one.
+// ErrIncompleteSnapshot is returned if the trailer is missing.
+func (s *Snapshot) next() (snapshotEntry, error) {
+	var entry snapshotEntry
+	err := s.dec.Decode(&entry)
+	switch {
+	case errors.Is(err, io.EOF):
+		return entry, ErrIncompleteSnapshot
+	case err != nil:
+		return entry, err
+	case entry.End:
+		// which also verifies the checksum of the stream
+		var after snapshotEntry
+		if err := s.dec.Decode(&after); !errors.Is(err, io.EOF) {
+			if err == nil {
+				err = errors.New("entries after the trailer")
+			}
+			return entry, err
+		}
+		return entry, io.EOF
+	}
+	return entry, nil
+}
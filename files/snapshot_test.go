@@ -0,0 +1,168 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordEvents records events as a snapshot, and returns the snapshot along
+// with the events passed through
+func recordEvents(t *testing.T, events []FileEvent) ([]byte, []FileEvent) {
+	t.Helper()
+	in := make(chan FileEvent, len(events))
+	out := make(chan FileEvent, len(events)+1)
+	for _, event := range events {
+		in <- event
+	}
+	close(in)
+
+	var buf bytes.Buffer
+	RecordSnapshot(context.Background(), &buf, in, out)
+	var forwarded []FileEvent
+	for event := range out {
+		forwarded = append(forwarded, event)
+	}
+	return buf.Bytes(), forwarded
+}
+
+func loadEvents(t *testing.T, data []byte) []FileEvent {
+	t.Helper()
+	snapshot, err := OpenSnapshot(bytes.NewReader(data))
+	require.NoError(t, err)
+	ch := make(chan FileEvent)
+	go snapshot.Load(context.Background(), ch)
+	var loaded []FileEvent
+	for event := range ch {
+		loaded = append(loaded, event)
+	}
+	return loaded
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	events := []FileEvent{
+		{File: File{Path: TotalPath, IsDir: true}},
+		{File: File{Path: "/", IsDir: true, DiskSize: 4096, Device: 1, Inode: 2}},
+		{File: File{Path: "/a", Size: 1, DiskSize: 4096, NumLinks: 2}},
+		{File: File{Path: "/a2", IsDuplicateLink: true, NumLinks: 2}},
+		{Error: errors.New("permission denied")},
+		{Error: &fs.PathError{Op: "open", Path: "/x", Err: errors.New("permission denied")}},
+		{File: File{Path: "/r", IsDir: true, ReadError: true}},
+		{File: File{Path: "/l", IsSymlink: true, LinkTarget: "a"}},
+		{File: File{Path: "/d", IsDir: true, Excluded: ExcludedOtherFS}},
+		{File: File{Path: "rel/x", IsDir: true}},
+		{File: File{Path: "rel/x/y", Excluded: ExcludedPattern}},
+	}
+
+	data, forwarded := recordEvents(t, events)
+	loaded := loadEvents(t, data)
+
+	assert.Equal(t, events, forwarded)
+	require.Len(t, loaded, len(events))
+	for i, event := range events {
+		if event.Error != nil {
+			assert.EqualError(t, loaded[i].Error, event.Error.Error())
+			var perr *fs.PathError
+			assert.Equal(t, errors.As(event.Error, &perr), errors.As(loaded[i].Error, &perr))
+		} else {
+			assert.Equal(t, event.File, loaded[i].File)
+		}
+	}
+}
+
+func TestSnapshot_StoresNamesBelowParents(t *testing.T) {
+	var events []FileEvent
+	events = append(events, FileEvent{File: File{Path: "/some/long/root/path", IsDir: true}})
+	for i := 0; i < 100; i++ {
+		events = append(events, FileEvent{File: File{Path: "/some/long/root/path/file", Size: int64(i)}})
+	}
+	withNames, _ := recordEvents(t, events)
+
+	for i := 1; i < len(events); i++ {
+		// no parent to refer to, so full paths are stored
+		events[i].File.Path = "/other/long/root/path/file"
+	}
+	withPaths, _ := recordEvents(t, events)
+
+	assert.Less(t, len(withNames), len(withPaths))
+}
+
+func TestSnapshot_RejectsOtherData(t *testing.T) {
+	_, err := OpenSnapshot(bytes.NewReader([]byte("not gzipped")))
+	assert.EqualError(t, err, "not a dux snapshot")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	require.NoError(t, gob.NewEncoder(gz).Encode(snapshotHeader{Magic: snapshotMagic, Version: SnapshotVersion + 1}))
+	require.NoError(t, gz.Close())
+	_, err = OpenSnapshot(&buf)
+	assert.ErrorContains(t, err, "newer than supported")
+}
+
+func TestSnapshot_ReportsTruncation(t *testing.T) {
+	data, _ := recordEvents(t, []FileEvent{
+		{File: File{Path: "a", IsDir: true}},
+		{File: File{Path: "a/b"}},
+	})
+
+	loaded := loadEvents(t, data[:len(data)-8])
+
+	require.NotEmpty(t, loaded)
+	assert.ErrorContains(t, loaded[len(loaded)-1].Error, "corrupt snapshot")
+}
+
+func TestSnapshot_DiskUsageOfSamePaths(t *testing.T) {
+	data, _ := recordEvents(t, []FileEvent{
+		{File: File{Path: TotalPath, IsDir: true}},
+		{File: File{Path: "a", IsDir: true, DiskSize: 4096}},
+		{File: File{Path: "a/x", DiskSize: 8192}},
+		{Error: errors.New("permission denied")},
+		{File: File{Path: "b", DiskSize: 4096}},
+	})
+	usage := func(paths ...string) (int64, bool) {
+		snapshot, err := OpenSnapshot(bytes.NewReader(data))
+		require.NoError(t, err)
+		return snapshot.DiskUsage(paths)
+	}
+
+	used, ok := usage("b", "./a")
+	assert.True(t, ok)
+	assert.Equal(t, int64(16384), used)
+
+	_, ok = usage("a")
+	assert.False(t, ok, "snapshot of other paths")
+	_, ok = usage("a", "b", "c")
+	assert.False(t, ok, "snapshot of fewer paths")
+}
+
+func TestSnapshot_CancelledIsIncomplete(t *testing.T) {
+	in := make(chan FileEvent, 1)
+	out := make(chan FileEvent, 1)
+	in <- FileEvent{File: File{Path: "a", IsDir: true, DiskSize: 4096}}
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf bytes.Buffer
+	go func() {
+		// forwarded, so recorded, before cancelling
+		<-out
+		cancel()
+	}()
+	RecordSnapshot(ctx, &buf, in, out)
+
+	loaded := loadEvents(t, buf.Bytes())
+
+	require.Len(t, loaded, 2)
+	assert.Equal(t, "a", loaded[0].File.Path)
+	assert.ErrorIs(t, loaded[1].Error, ErrIncompleteSnapshot)
+
+	snapshot, err := OpenSnapshot(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	_, ok := snapshot.DiskUsage([]string{"a"})
+	assert.False(t, ok, "usage of an incomplete snapshot")
+}
@@ -0,0 +1,70 @@
+package files
+
+import (
+	"io/fs"
+	"os"
+)
+
+// source is where a walker reads files from
+type source interface {
+	stat(path string) (fs.FileInfo, error)
+	readDir(path string) ([]fs.DirEntry, error)
+	open(path string) (fs.File, error)
+	readlink(path string) (string, error)
+}
+
+// osSource reads from the filesystem of the operating system
+type osSource struct {
+	// readDirFunc defaults to os.ReadDir
+	readDirFunc ReadDir
+}
+
+func (s osSource) stat(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (s osSource) readDir(path string) ([]fs.DirEntry, error) {
+	if s.readDirFunc == nil {
+		return os.ReadDir(path)
+	}
+	return s.readDirFunc(path)
+}
+
+func (s osSource) open(path string) (fs.File, error) {
+	return os.Open(path)
+}
+
+func (s osSource) readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+// fsSource reads from an fs.FS, in which paths are slash-separated and
+// relative to its root, see fs.ValidPath
+type fsSource struct {
+	fsys fs.FS
+}
+
+func (s fsSource) stat(path string) (fs.FileInfo, error) {
+	// uses fs.StatFS when implemented
+	return fs.Stat(s.fsys, path)
+}
+
+func (s fsSource) readDir(path string) ([]fs.DirEntry, error) {
+	// uses fs.ReadDirFS when implemented
+	return fs.ReadDir(s.fsys, path)
+}
+
+func (s fsSource) open(path string) (fs.File, error) {
+	return s.fsys.Open(path)
+}
+
+// readlink returns the target of a symbolic link if fsys can tell, like
+// fs.ReadLinkFS of later versions of Go, and otherwise an empty target
+func (s fsSource) readlink(path string) (string, error) {
+	if rl, ok := s.fsys.(interface {
+		ReadLink(name string) (string, error)
+	}); ok {
+		return rl.ReadLink(path)
+	}
+	return "", nil
+}
@@ -0,0 +1,76 @@
+package files
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func walkFS(t *testing.T, fsys fs.FS, paths []string, opts WalkOptions) ([]File, []error) {
+	t.Helper()
+	ch := make(chan FileEvent)
+	go WalkFS(context.Background(), fsys, paths, ch, opts)
+	var files []File
+	var errs []error
+	for event := range ch {
+		if event.Error != nil {
+			errs = append(errs, event.Error)
+		} else {
+			files = append(files, event.File)
+		}
+	}
+	return files, errs
+}
+
+func TestWalkFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/main.go":        {Data: []byte("package main")},
+		"src/vendor/lib.go":  {Data: []byte("package lib")},
+		"src/.gitignore":     {Data: []byte("vendor/\n")},
+		"docs/readme.md":     {Data: []byte("# readme")},
+		"docs/empty":         {Mode: fs.ModeDir},
+		"docs/link":          {Mode: fs.ModeSymlink},
+		"top.txt":            {Data: []byte("top")},
+		"top-level/file.txt": {Data: []byte("x")},
+	}
+
+	files, errs := walkFS(t, fsys, []string{"src", "docs", "missing"}, WalkOptions{GitIgnore: true})
+
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], fs.ErrNotExist)
+	byPath := make(map[string]File)
+	for _, f := range files {
+		byPath[f.Path] = f
+	}
+	assert.Equal(t, File{Path: TotalPath, IsDir: true}, files[0])
+	assert.Equal(t, int64(12), byPath["src/main.go"].Size)
+	assert.Equal(t, ExcludedPattern, byPath["src/vendor"].Excluded)
+	assert.NotContains(t, byPath, "src/vendor/lib.go")
+	assert.True(t, byPath["docs/empty"].IsDir)
+	assert.True(t, byPath["docs/link"].IsSymlink)
+	assert.NotContains(t, byPath, "top.txt")
+	assert.Len(t, files, 9)
+}
+
+func TestWalkFS_Root(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/b": {Data: []byte("12")},
+		"c":   {Data: []byte("3")},
+	}
+
+	files, errs := walkFS(t, fsys, []string{"."}, WalkOptions{Jobs: 4})
+
+	require.Empty(t, errs)
+	fs := NewFS()
+	for _, f := range files {
+		require.NoError(t, fs.Insert(f))
+	}
+	root, _ := fs.Root()
+	assert.Equal(t, ".", root.File().Path)
+	assert.Equal(t, int64(3), root.File().Size)
+	assert.Equal(t, 3, root.File().NumDescendants)
+}
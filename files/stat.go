@@ -0,0 +1,57 @@
+package files
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// blockSize is the unit of syscall.Stat_t.Blocks, regardless of the block
+// size of the filesystem
+const blockSize = 512
+
+// newFile returns a File for path, filled in with what is known from info
+func newFile(path string, info fs.FileInfo) File {
+	f := File{
+		Path:     path,
+		IsDir:    info.IsDir(),
+		DiskSize: info.Size(),
+		ModTime:  info.ModTime(),
+	}
+	// the apparent size of a directory is the sum of its contents
+	if !f.IsDir {
+		f.Size = info.Size()
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		f.DiskSize = st.Blocks * blockSize
+		f.Device = uint64(st.Dev)
+		f.Inode = st.Ino
+		f.NumLinks = uint64(st.Nlink)
+		f.UID = st.Uid
+		f.GID = st.Gid
+		f.HasOwner = true
+	}
+	return f
+}
+
+// lstatFile returns a File for path in src, given its info from lstat(2).
+// Symbolic links are resolved if follow is set, except when dangling.
+func lstatFile(src source, path string, info fs.FileInfo, follow bool) (File, error) {
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return newFile(path, info), nil
+	}
+
+	target, err := src.readlink(path)
+	if err != nil {
+		return File{}, err
+	}
+	if follow {
+		targetInfo, err := src.stat(path)
+		if err == nil {
+			info = targetInfo
+		}
+	}
+	f := newFile(path, info)
+	f.IsSymlink = true
+	f.LinkTarget = target
+	return f, nil
+}
@@ -0,0 +1,106 @@
+package files
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Throttle limits the rate of I/O operations of walkers with a token bucket,
+// and can pause them altogether. A nil Throttle never waits.
+type Throttle struct {
+	mu sync.Mutex
+	// rate is the number of operations per second, 0 for no limit
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// resumed is closed when a pause is over, and nil when not paused
+	resumed chan struct{}
+}
+
+// NewThrottle returns a Throttle allowing up to maxIOPS operations per
+// second, or any number of operations if maxIOPS is 0
+func NewThrottle(maxIOPS int) *Throttle {
+	// allow short bursts, but not more than a tenth of a second's worth
+	burst := float64(maxIOPS) / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &Throttle{
+		rate:   float64(maxIOPS),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until an operation is allowed, or ctx is cancelled
+func (t *Throttle) Wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	for {
+		delay, resumed := t.take()
+		if delay == 0 && resumed == nil {
+			return nil
+		}
+
+		var timer *time.Timer
+		var ready <-chan time.Time
+		if resumed == nil {
+			timer = time.NewTimer(delay)
+			ready = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return ctx.Err()
+		case <-ready:
+		case <-resumed:
+		}
+	}
+}
+
+// take takes a token if there is one, and otherwise returns how long to wait
+// for one, or a channel to wait on while paused
+func (t *Throttle) take() (time.Duration, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.resumed != nil {
+		return 0, t.resumed
+	}
+	if t.rate == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+	if t.tokens >= 1 {
+		t.tokens--
+		return 0, nil
+	}
+	return time.Duration((1 - t.tokens) / t.rate * float64(time.Second)), nil
+}
+
+// SetPaused pauses or resumes the walkers waiting on t
+func (t *Throttle) SetPaused(paused bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case paused && t.resumed == nil:
+		t.resumed = make(chan struct{})
+	case !paused && t.resumed != nil:
+		close(t.resumed)
+		t.resumed = nil
+	}
+}
@@ -0,0 +1,74 @@
+package files
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle_LimitsRate(t *testing.T) {
+	throttle := NewThrottle(200)
+	start := time.Now()
+
+	// a burst of 20, then 10 more at 5ms each
+	for i := 0; i < 30; i++ {
+		require.NoError(t, throttle.Wait(context.Background()))
+	}
+
+	assert.GreaterOrEqual(t, time.Since(start), 45*time.Millisecond)
+}
+
+func TestThrottle_UnlimitedAndNil(t *testing.T) {
+	var nilThrottle *Throttle
+	for _, throttle := range []*Throttle{NewThrottle(0), nilThrottle} {
+		start := time.Now()
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, throttle.Wait(context.Background()))
+		}
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	}
+}
+
+func TestThrottle_Pause(t *testing.T) {
+	throttle := NewThrottle(0)
+	throttle.SetPaused(true)
+	done := make(chan error)
+	go func() {
+		done <- throttle.Wait(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Wait returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	throttle.SetPaused(false)
+	assert.NoError(t, <-done)
+
+	throttle.SetPaused(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, throttle.Wait(ctx), context.Canceled)
+}
+
+func TestWalk_PausedByThrottle(t *testing.T) {
+	throttle := NewThrottle(0)
+	throttle.SetPaused(true)
+	ch := make(chan FileEvent)
+	go Walk(context.Background(), "../testdata/example", ch, WalkOptions{Throttle: throttle})
+
+	select {
+	case <-ch:
+		t.Fatal("walked while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	throttle.SetPaused(false)
+	n := 0
+	for range ch {
+		n++
+	}
+	assert.Equal(t, 7, n)
+}
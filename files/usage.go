@@ -0,0 +1,66 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// FilesystemUsage returns the disk usage of the filesystems mounted at paths,
+// as reported by statfs(2). It reports false unless each path is the mount
+// point of a filesystem, as any other walk reads only a part of what is used.
+func FilesystemUsage(paths []string) (int64, bool) {
+	var used int64
+	devices := make(map[uint64]bool)
+	for _, path := range uniqueRoots(paths) {
+		device, ok := mountPointDevice(path)
+		if !ok {
+			return 0, false
+		}
+		if devices[device] {
+			continue
+		}
+		devices[device] = true
+
+		var st unix.Statfs_t
+		if err := unix.Statfs(path, &st); err != nil {
+			return 0, false
+		}
+		used += int64((st.Blocks - st.Bfree) * uint64(st.Bsize))
+	}
+	return used, len(devices) > 0
+}
+
+// mountPointDevice returns the device of the directory at path, if a
+// filesystem is mounted there
+func mountPointDevice(path string) (uint64, bool) {
+	device, ok := deviceOf(path)
+	if !ok {
+		return 0, false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return 0, false
+	}
+	parent := filepath.Dir(abs)
+	if parent == abs {
+		// the root directory
+		return device, true
+	}
+	parentDevice, ok := deviceOf(parent)
+	return device, ok && parentDevice != device
+}
+
+func deviceOf(path string) (uint64, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return 0, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
@@ -0,0 +1,498 @@
+package files
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jensgreen/dux/cancellable"
+)
+
+// WalkOptions configures a Walk.
+type WalkOptions struct {
+	// ReadDir lists the entries of a directory. Defaults to os.ReadDir.
+	ReadDir ReadDir
+	// Jobs is the number of directories read concurrently. Since each worker
+	// holds at most one open directory at a time, this also caps the number
+	// of file descriptors used by the walker. Values below 1 mean 1.
+	Jobs int
+	// CountLinks counts the size of hard links to the same inode as many
+	// times as they are found, like du -l. By default, only the first link
+	// found carries the size of the inode.
+	CountLinks bool
+	// OneFileSystem skips directories on other filesystems than the root,
+	// like du -x. Skipped directories are sent with ExcludedOtherFS.
+	OneFileSystem bool
+	// Exclude skips files and directories matching any of the patterns.
+	// Skipped entries are sent with ExcludedPattern.
+	Exclude *Patterns
+	// GitIgnore additionally excludes what is matched by .gitignore files
+	// found in the walked directories
+	GitIgnore bool
+	// FollowSymlinks walks symbolic links to directories and counts the size
+	// of link targets rather than of the links, like du -L. Every inode is
+	// counted once, so links to targets already walked and links forming
+	// cycles are sent as duplicates and not descended into.
+	FollowSymlinks bool
+	// Watch, if set, watches every walked directory for changes
+	Watch *Watcher
+	// Throttle, if set, limits the rate of reading directories and file
+	// information, and pauses the walk when paused
+	Throttle *Throttle
+	// Progress, if set, counts the directories read and the files found
+	Progress *Progress
+	// Inodes are the inodes already counted, shared with other walks into
+	// the same FS. Defaults to a set of the walk's own.
+	Inodes *Inodes
+	// Base is the directory that Exclude patterns and OneFileSystem are
+	// relative to, when walking a part of an earlier walk of Base. Defaults
+	// to each walked path.
+	Base string
+}
+
+func withDefaults(opts WalkOptions) WalkOptions {
+	if opts.ReadDir == nil {
+		opts.ReadDir = os.ReadDir
+	}
+	if opts.Jobs < 1 {
+		opts.Jobs = 1
+	}
+	if opts.Inodes == nil {
+		opts.Inodes = NewInodes()
+	}
+	return opts
+}
+
+// WalkDir walks the file tree rooted at path on a single goroutine, see Walk.
+func WalkDir(ctx context.Context, path string, fileEvents chan<- FileEvent, readDir ReadDir) {
+	Walk(ctx, path, fileEvents, WalkOptions{ReadDir: readDir, Jobs: 1})
+}
+
+// Walk walks the file tree rooted at path and sends a FileEvent for each file
+// found, and for each error encountered. A directory is always sent before its
+// children, but the order between siblings and cousins is unspecified when
+// more than one job is used. fileEvents is closed when the walk is done or ctx
+// is cancelled.
+func Walk(ctx context.Context, path string, fileEvents chan<- FileEvent, opts WalkOptions) {
+	WalkPaths(ctx, []string{path}, fileEvents, opts)
+}
+
+// WalkPaths is like Walk, but for several paths, which may be either
+// directories or other files. Given more than one path, a synthetic root
+// File, for which IsTotal is true, is sent first, followed by the paths as its
+// children. Paths that are inside other paths are only walked once. Paths to
+// tar, tar.gz and zip archives are walked as directories of their members.
+func WalkPaths(ctx context.Context, paths []string, fileEvents chan<- FileEvent, opts WalkOptions) {
+	opts = withDefaults(opts)
+	walkPaths(ctx, osSource{readDirFunc: opts.ReadDir}, paths, fileEvents, opts)
+}
+
+// WalkFS is like WalkPaths, but walks paths in fsys rather than in the
+// filesystem of the operating system. Paths are slash-separated and relative
+// to the root of fsys, which is ".", see fs.ValidPath. fs.StatFS and
+// fs.ReadDirFS are used when implemented by fsys. The ReadDir and Watch
+// options are ignored.
+func WalkFS(ctx context.Context, fsys fs.FS, paths []string, fileEvents chan<- FileEvent, opts WalkOptions) {
+	opts = withDefaults(opts)
+	opts.ReadDir = nil
+	opts.Watch = nil
+	walkPaths(ctx, fsSource{fsys: fsys}, paths, fileEvents, opts)
+}
+
+func walkPaths(ctx context.Context, src source, paths []string, fileEvents chan<- FileEvent, opts WalkOptions) {
+	defer func() {
+		log.Println("Closing FileEvent channel")
+		close(fileEvents)
+	}()
+
+	w := &walker{
+		ctx:        ctx,
+		src:        src,
+		fileEvents: fileEvents,
+		opts:       opts,
+		queue:      newDirQueue(),
+	}
+
+	paths = uniqueRoots(paths)
+	if len(paths) > 1 {
+		total := File{Path: TotalPath, IsDir: true}
+		log.Println("Sending FileEvent for total")
+		err := cancellable.Send(ctx, fileEvents, FileEvent{File: total})
+		if err != nil {
+			return
+		}
+	}
+
+	var base *walkRoot
+	if opts.Base != "" {
+		if info, err := src.stat(opts.Base); err == nil {
+			base = &walkRoot{path: opts.Base, device: newFile(opts.Base, info).Device}
+		}
+	}
+
+	var roots []dir
+	for _, path := range paths {
+		if opts.Throttle.Wait(ctx) != nil {
+			return
+		}
+		rootInfo, err := src.stat(path)
+		if err != nil {
+			err = cancellable.Send(ctx, fileEvents, FileEvent{Error: err})
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		f := newFile(path, rootInfo)
+		if tracksInode(f, opts) && !opts.Inodes.count(f) {
+			if f.IsDir {
+				// e.g. the same directory given twice through different links
+				continue
+			}
+			f.Size = 0
+			f.DiskSize = 0
+			f.IsDuplicateLink = true
+		}
+		if !f.IsDir && archiveKindOf(path) != notArchive {
+			err = w.walkArchive(f)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		log.Println("Sending FileEvent for", f.Path)
+		err = cancellable.Send(ctx, fileEvents, FileEvent{File: f})
+		if err != nil {
+			return
+		}
+		opts.Progress.addFile(f)
+		if f.IsDir {
+			root := &walkRoot{path: path, device: f.Device}
+			if base != nil {
+				root = base
+			}
+			roots = append(roots, dir{file: f, root: root, exclude: opts.Exclude})
+		}
+	}
+	w.run(roots)
+}
+
+// walkArchive sends the archive a as a directory, followed by its members.
+// Archives that cannot be read are sent as a regular file, after the error.
+func (w *walker) walkArchive(a File) error {
+	members, err := readArchive(w.src, a)
+	if err != nil {
+		err = cancellable.Send(w.ctx, w.fileEvents, FileEvent{Error: err})
+		if err != nil {
+			return err
+		}
+		w.opts.Progress.addFile(a)
+		return cancellable.Send(w.ctx, w.fileEvents, FileEvent{File: a})
+	}
+
+	a.IsDir = true
+	a.IsArchive = true
+	// the archive is the sum of its members
+	a.Size = 0
+	a.DiskSize = 0
+	for _, f := range append([]File{a}, members...) {
+		log.Println("Sending FileEvent for", f.Path)
+		err = cancellable.Send(w.ctx, w.fileEvents, FileEvent{File: f})
+		if err != nil {
+			return err
+		}
+		w.opts.Progress.addFile(f)
+	}
+	return nil
+}
+
+// uniqueRoots returns the cleaned paths, except those inside another path
+func uniqueRoots(paths []string) []string {
+	var roots []string
+	for i, path := range paths {
+		path = filepath.Clean(path)
+		isInside := false
+		for j, other := range paths {
+			rel, err := filepath.Rel(filepath.Clean(other), path)
+			inside := err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+			// of two equal paths, keep the first one
+			if inside && (rel != "." || j < i) {
+				isInside = true
+				break
+			}
+		}
+		if !isInside {
+			roots = append(roots, path)
+		}
+	}
+	return roots
+}
+
+type walker struct {
+	ctx        context.Context
+	src        source
+	fileEvents chan<- FileEvent
+	opts       WalkOptions
+	queue      *dirQueue
+}
+
+// walkRoot is one of the paths given to WalkPaths
+type walkRoot struct {
+	path   string
+	device uint64
+}
+
+// dir is a directory waiting to be walked
+type dir struct {
+	file File
+	root *walkRoot
+	// exclude holds the patterns that apply inside the directory
+	exclude *Patterns
+}
+
+func (w *walker) run(roots []dir) {
+	w.queue.push(roots...)
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.Jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *walker) work() {
+	for {
+		d, ok := w.queue.pop()
+		if !ok {
+			return
+		}
+		subdirs, err := w.walkDir(d)
+		if err != nil {
+			// cancelled: make the other workers give up too
+			w.queue.close()
+		} else {
+			// push before marking dir as done, so the queue is never
+			// observed as empty while there is more work to do
+			w.queue.push(subdirs...)
+		}
+		w.queue.done()
+	}
+}
+
+// walkDir sends FileEvents for the entries of d, and returns the
+// subdirectories that remain to be walked. Errors are only returned when
+// sending is cancelled; other errors are sent as FileEvents.
+func (w *walker) walkDir(d dir) ([]dir, error) {
+	// watch before reading, so that no change goes unnoticed
+	if w.opts.Watch != nil {
+		if err := w.opts.Watch.add(d); err != nil {
+			err := cancellable.Send(w.ctx, w.fileEvents, FileEvent{Error: err})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := w.opts.Throttle.Wait(w.ctx); err != nil {
+		return nil, err
+	}
+	w.opts.Progress.visitDir(d.file.Path)
+	entries, err := w.src.readDir(d.file.Path)
+	if err != nil {
+		err := cancellable.Send(w.ctx, w.fileEvents, FileEvent{Error: err})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	exclude := d.exclude
+	if w.opts.GitIgnore && hasEntry(entries, ".gitignore") {
+		gitignore, err := w.readGitIgnore(d)
+		if err != nil {
+			err := cancellable.Send(w.ctx, w.fileEvents, FileEvent{Error: err})
+			if err != nil {
+				return nil, err
+			}
+		}
+		exclude = exclude.with(gitignore)
+		if w.opts.Watch != nil {
+			_ = w.opts.Watch.add(dir{file: d.file, root: d.root, exclude: exclude})
+		}
+	}
+
+	var subdirs []dir
+	for _, entry := range entries {
+		path := filepath.Join(d.file.Path, entry.Name())
+		if exclude.Match(d.root.relPath(path), entry.IsDir()) {
+			f := File{Path: path, IsDir: entry.IsDir(), Excluded: ExcludedPattern}
+			log.Println("Sending FileEvent for excluded", f.Path)
+			err := cancellable.Send(w.ctx, w.fileEvents, FileEvent{File: f})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := w.opts.Throttle.Wait(w.ctx); err != nil {
+			return nil, err
+		}
+		f, err := w.newFile(path, entry)
+		if err != nil {
+			err := cancellable.Send(w.ctx, w.fileEvents, FileEvent{Error: err})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if tracksInode(f, w.opts) && !w.opts.Inodes.count(f) {
+			f.Size = 0
+			f.DiskSize = 0
+			f.IsDuplicateLink = true
+		}
+		if f.IsDir && w.opts.OneFileSystem && f.Device != d.root.device {
+			f.Excluded = ExcludedOtherFS
+		}
+		log.Println("Sending FileEvent for", f.Path)
+		err = cancellable.Send(w.ctx, w.fileEvents, FileEvent{File: f})
+		if err != nil {
+			return nil, err
+		}
+		w.opts.Progress.addFile(f)
+		if f.IsDir && f.Excluded == NotExcluded && !f.IsDuplicateLink {
+			subdirs = append(subdirs, dir{file: f, root: d.root, exclude: exclude})
+		}
+	}
+	return subdirs, nil
+}
+
+// relPath returns path relative to the root, slash-separated
+func (r *walkRoot) relPath(path string) string {
+	rel, err := filepath.Rel(r.path, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func hasEntry(entries []fs.DirEntry, name string) bool {
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readGitIgnore returns the patterns of the .gitignore file in d
+func (w *walker) readGitIgnore(d dir) (*Patterns, error) {
+	f, err := w.src.open(filepath.Join(d.file.Path, ".gitignore"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	base := d.root.relPath(d.file.Path)
+	if base == "." {
+		base = ""
+	}
+	patterns := &Patterns{}
+	err = patterns.AddFrom(f, base)
+	return patterns, err
+}
+
+// newFile returns the File for a directory entry, resolving symbolic links if
+// they are followed
+func (w *walker) newFile(path string, entry fs.DirEntry) (File, error) {
+	info, err := entry.Info()
+	if err != nil {
+		return File{}, err
+	}
+	return lstatFile(w.src, path, info, w.opts.FollowSymlinks)
+}
+
+// tracksInode reports whether f should only be counted the first time its
+// inode is found
+func tracksInode(f File, opts WalkOptions) bool {
+	switch {
+	case f.IsDir:
+		// followed links can lead to directories already walked, or to cycles
+		return opts.FollowSymlinks
+	case opts.CountLinks:
+		return false
+	default:
+		return f.NumLinks > 1 || opts.FollowSymlinks
+	}
+}
+
+// dirQueue is a LIFO queue of directories waiting to be walked. It keeps
+// track of directories that are queued or being walked, so that workers know
+// when the walk is complete.
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	dirs    []dir
+	pending int
+	closed  bool
+}
+
+func newDirQueue() *dirQueue {
+	q := &dirQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds dirs to the queue. They are popped in the given order.
+func (q *dirQueue) push(dirs ...dir) {
+	if len(dirs) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		q.dirs = append(q.dirs, dirs[i])
+	}
+	q.pending += len(dirs)
+	q.cond.Broadcast()
+}
+
+// pop blocks until a directory is available, and returns false once the walk
+// is complete or the queue is closed. Each popped dir must be marked as done.
+func (q *dirQueue) pop() (dir, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.dirs) == 0 && q.pending > 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.dirs) == 0 || q.closed {
+		return dir{}, false
+	}
+	last := len(q.dirs) - 1
+	d := q.dirs[last]
+	q.dirs = q.dirs[:last]
+	return d, true
+}
+
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending--
+	if q.pending == 0 {
+		q.cond.Broadcast()
+	}
+}
+
+func (q *dirQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
@@ -0,0 +1,280 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/jensgreen/dux/cancellable"
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_ATTRIB |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DONT_FOLLOW | unix.IN_ONLYDIR
+
+// pollTimeout is how often, in milliseconds, the watcher checks for
+// cancellation while waiting for inotify events
+const pollTimeout = 100
+
+// Watcher watches walked directories with inotify, and turns changes to their
+// contents into FileEvents. Pass it to Walk through WalkOptions.Watch to have
+// every walked directory watched.
+type Watcher struct {
+	fd   int
+	opts WalkOptions
+
+	mu         sync.Mutex
+	dirs       map[int]dir
+	wds        map[string]int
+	limitError bool
+}
+
+func NewWatcher() (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	return &Watcher{
+		fd:   fd,
+		dirs: make(map[int]dir),
+		wds:  make(map[string]int),
+	}, nil
+}
+
+// add starts watching d, or updates the exclude patterns of d if already
+// watched
+func (w *Watcher) add(d dir) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wd, err := unix.InotifyAddWatch(w.fd, d.file.Path, watchMask)
+	if errors.Is(err, unix.ENOSPC) {
+		// report the limit once, not once per directory
+		if w.limitError {
+			return nil
+		}
+		w.limitError = true
+		return fmt.Errorf("cannot watch '%s': inotify watch limit reached, see /proc/sys/fs/inotify/max_user_watches", d.file.Path)
+	} else if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: d.file.Path, Err: err}
+	}
+	w.dirs[wd] = d
+	w.wds[d.file.Path] = wd
+	return nil
+}
+
+// remove stops watching path and all directories below it
+func (w *Watcher) remove(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	prefix := path + string(filepath.Separator)
+	for p, wd := range w.wds {
+		if p == path || strings.HasPrefix(p, prefix) {
+			_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.wds, p)
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+func (w *Watcher) lookup(wd int) (dir, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	d, ok := w.dirs[wd]
+	return d, ok
+}
+
+func (w *Watcher) forget(wd int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if d, ok := w.dirs[wd]; ok {
+		delete(w.wds, d.file.Path)
+		delete(w.dirs, wd)
+	}
+}
+
+// Run sends FileEvents for changes in the watched directories until ctx is
+// cancelled, then closes fileEvents. Events are buffered while fileEvents is
+// not read from, so that the kernel queue does not overflow. New directories
+// are walked with opts, and watched as well. Hard links are counted once
+// along with the walks that share opts.Inodes.
+func (w *Watcher) Run(ctx context.Context, fileEvents chan<- FileEvent, opts WalkOptions) {
+	defer func() {
+		log.Println("Closing watch FileEvent channel")
+		close(fileEvents)
+	}()
+	defer unix.Close(w.fd)
+	w.opts = withDefaults(opts)
+	w.opts.Watch = w
+
+	changes := make(chan FileEvent)
+	go w.read(ctx, changes)
+
+	var pending []FileEvent
+	for {
+		var out chan<- FileEvent
+		var next FileEvent
+		if len(pending) > 0 {
+			out = fileEvents
+			next = pending[0]
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-changes:
+			pending = append(pending, event)
+		case out <- next:
+			pending = pending[1:]
+		}
+	}
+}
+
+// read polls the inotify file descriptor and sends FileEvents for what has
+// changed
+func (w *Watcher) read(ctx context.Context, changes chan<- FileEvent) {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	for ctx.Err() == nil {
+		n, err := unix.Poll(fds, pollTimeout)
+		if errors.Is(err, unix.EINTR) || n == 0 {
+			continue
+		} else if err != nil {
+			_ = cancellable.Send(ctx, changes, FileEvent{Error: fmt.Errorf("inotify: %w", err)})
+			return
+		}
+
+		n, err = unix.Read(w.fd, buf)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			continue
+		} else if err != nil {
+			_ = cancellable.Send(ctx, changes, FileEvent{Error: fmt.Errorf("inotify: %w", err)})
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(raw.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			offset += unix.SizeofInotifyEvent + int(raw.Len)
+
+			err := w.handle(ctx, changes, int(raw.Wd), raw.Mask, name)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle sends the FileEvents for a single inotify event. Errors are only
+// returned when sending is cancelled.
+func (w *Watcher) handle(ctx context.Context, changes chan<- FileEvent, wd int, mask uint32, name string) error {
+	send := func(event FileEvent) error {
+		return cancellable.Send(ctx, changes, event)
+	}
+
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		return send(FileEvent{Error: errors.New("inotify: event queue overflowed, some changes are not shown")})
+	}
+	if mask&unix.IN_IGNORED != 0 {
+		w.forget(wd)
+		return nil
+	}
+	d, ok := w.lookup(wd)
+	if !ok || name == "" {
+		// events about the watched directory itself are handled by its parent
+		return nil
+	}
+	path := filepath.Join(d.file.Path, name)
+	isDir := mask&unix.IN_ISDIR != 0
+
+	switch {
+	case mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+		if isDir {
+			w.remove(path)
+		}
+		remaining := w.opts.Inodes.Forget(path)
+		if err := send(FileEvent{Kind: FileRemoved, File: File{Path: path, IsDir: isDir}}); err != nil {
+			return err
+		}
+		// the sizes of inodes counted at removed links are counted at
+		// remaining links instead
+		for _, link := range remaining {
+			f, err := w.lstat(link)
+			if err != nil {
+				continue
+			}
+			w.countLink(&f)
+			if err := send(FileEvent{Kind: FileUpdated, File: f}); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+		if d.exclude.Match(d.root.relPath(path), isDir) {
+			return send(FileEvent{File: File{Path: path, IsDir: isDir, Excluded: ExcludedPattern}})
+		}
+		f, err := w.lstat(path)
+		if err != nil {
+			// already gone again
+			return nil
+		}
+		if f.IsDir && w.opts.OneFileSystem && f.Device != d.root.device {
+			f.Excluded = ExcludedOtherFS
+		}
+		w.countLink(&f)
+		err = send(FileEvent{File: f})
+		if err != nil || !f.IsDir || f.Excluded != NotExcluded || f.IsDuplicateLink {
+			return err
+		}
+		// walk the new directory, which may already have contents, and
+		// watch it and its subdirectories
+		sub := &walker{
+			ctx:        ctx,
+			src:        osSource{readDirFunc: w.opts.ReadDir},
+			fileEvents: changes,
+			opts:       w.opts,
+			queue:      newDirQueue(),
+		}
+		sub.run([]dir{{file: f, root: d.root, exclude: d.exclude}})
+		return ctx.Err()
+
+	case mask&(unix.IN_MODIFY|unix.IN_ATTRIB) != 0:
+		if d.exclude.Match(d.root.relPath(path), isDir) {
+			return nil
+		}
+		f, err := w.lstat(path)
+		if err != nil {
+			return nil
+		}
+		w.countLink(&f)
+		return send(FileEvent{Kind: FileUpdated, File: f})
+	}
+	return nil
+}
+
+// countLink makes f a duplicate link if its inode is counted at another link,
+// as in a walk
+func (w *Watcher) countLink(f *File) {
+	if tracksInode(*f, w.opts) && !w.opts.Inodes.count(*f) {
+		f.Size = 0
+		f.DiskSize = 0
+		f.IsDuplicateLink = true
+	}
+}
+
+func (w *Watcher) lstat(path string) (File, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return File{}, err
+	}
+	return lstatFile(osSource{}, path, info, w.opts.FollowSymlinks)
+}
@@ -0,0 +1,181 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher_SendsChangesInWalkedDirs(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "old"), []byte("x"), 0o644))
+
+	watcher, err := NewWatcher()
+	require.NoError(t, err)
+	opts := WalkOptions{Watch: watcher}
+	walkEvents := make(chan FileEvent, 10)
+	Walk(context.Background(), root, walkEvents, opts)
+	for event := range walkEvents {
+		require.NoError(t, event.Error)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchEvents := make(chan FileEvent)
+	go watcher.Run(ctx, watchEvents, opts)
+
+	next := func() FileEvent {
+		select {
+		case event := <-watchEvents:
+			require.NoError(t, event.Error)
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for FileEvent")
+		}
+		return FileEvent{}
+	}
+
+	require.NoError(t, os.Remove(filepath.Join(root, "sub", "old")))
+	event := next()
+	assert.Equal(t, FileRemoved, event.Kind)
+	assert.Equal(t, filepath.Join(root, "sub", "old"), event.File.Path)
+
+	// a new directory is walked, and its contents sent as well
+	tmp := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(tmp, "new"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "new", "file"), []byte("hello"), 0o644))
+	require.NoError(t, os.Rename(filepath.Join(tmp, "new"), filepath.Join(root, "sub", "new")))
+	event = next()
+	assert.Equal(t, FileCreated, event.Kind)
+	assert.Equal(t, filepath.Join(root, "sub", "new"), event.File.Path)
+	event = next()
+	assert.Equal(t, FileCreated, event.Kind)
+	assert.Equal(t, filepath.Join(root, "sub", "new", "file"), event.File.Path)
+	assert.Equal(t, int64(5), event.File.Size)
+}
+
+func TestWatcher_CountsHardLinksOnceWithTheWalk(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file"), []byte("hello"), 0o644))
+	require.NoError(t, os.Link(filepath.Join(root, "file"), filepath.Join(root, "link")))
+
+	watcher, err := NewWatcher()
+	require.NoError(t, err)
+	opts := WalkOptions{Watch: watcher, Inodes: NewInodes()}
+	walkEvents := make(chan FileEvent, 10)
+	Walk(context.Background(), root, walkEvents, opts)
+	var sizes int64
+	for event := range walkEvents {
+		require.NoError(t, event.Error)
+		if !event.File.IsDir {
+			sizes += event.File.Size
+		}
+	}
+	assert.Equal(t, int64(5), sizes)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchEvents := make(chan FileEvent)
+	go watcher.Run(ctx, watchEvents, opts)
+
+	next := func() FileEvent {
+		select {
+		case event := <-watchEvents:
+			require.NoError(t, event.Error)
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for FileEvent")
+		}
+		return FileEvent{}
+	}
+
+	// another link to the inode counted by the walk
+	require.NoError(t, os.Link(filepath.Join(root, "file"), filepath.Join(root, "new")))
+	event := next()
+	assert.Equal(t, filepath.Join(root, "new"), event.File.Path)
+	assert.True(t, event.File.IsDuplicateLink)
+	assert.Zero(t, event.File.Size)
+
+	// changes to the inode are seen through every link, but only counted at
+	// the one counted by the walk
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file"), []byte("hello, world"), 0o644))
+	counted := ""
+	for {
+		event = next()
+		if event.Kind != FileUpdated {
+			continue
+		}
+		if !event.File.IsDuplicateLink {
+			if counted != "" {
+				assert.Equal(t, counted, event.File.Path, "counted at two links")
+			}
+			counted = event.File.Path
+		}
+		if event.File.Size == 12 {
+			break
+		}
+		if event.File.IsDuplicateLink {
+			assert.Zero(t, event.File.Size)
+		}
+	}
+	assert.NotEqual(t, filepath.Join(root, "new"), counted)
+}
+
+func TestWatcher_CountsRemainingLinkOfRemovedHardLink(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a"), []byte("hello"), 0o644))
+	require.NoError(t, os.Link(filepath.Join(root, "a"), filepath.Join(root, "b")))
+
+	watcher, err := NewWatcher()
+	require.NoError(t, err)
+	opts := WalkOptions{Watch: watcher, Inodes: NewInodes()}
+	walkEvents := make(chan FileEvent, 10)
+	Walk(context.Background(), root, walkEvents, opts)
+	counted, other := "", ""
+	for event := range walkEvents {
+		require.NoError(t, event.Error)
+		switch {
+		case event.File.IsDir:
+		case event.File.IsDuplicateLink:
+			other = event.File.Path
+		default:
+			counted = event.File.Path
+		}
+	}
+	require.NotEmpty(t, counted)
+	require.NotEmpty(t, other)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchEvents := make(chan FileEvent)
+	go watcher.Run(ctx, watchEvents, opts)
+
+	next := func() FileEvent {
+		select {
+		case event := <-watchEvents:
+			require.NoError(t, event.Error)
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for FileEvent")
+		}
+		return FileEvent{}
+	}
+
+	require.NoError(t, os.Remove(counted))
+	event := next()
+	assert.Equal(t, FileRemoved, event.Kind)
+	assert.Equal(t, counted, event.File.Path)
+
+	// the remaining link is counted once its link count changes
+	event = next()
+	assert.Equal(t, FileUpdated, event.Kind)
+	assert.Equal(t, other, event.File.Path)
+	assert.False(t, event.File.IsDuplicateLink)
+	assert.Equal(t, int64(5), event.File.Size)
+}
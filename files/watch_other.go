@@ -0,0 +1,26 @@
+//go:build !linux
+
+package files
+
+import (
+	"context"
+	"errors"
+)
+
+// Watcher watches walked directories for changes. It is only supported on
+// Linux.
+type Watcher struct{}
+
+func NewWatcher() (*Watcher, error) {
+	return nil, errors.New("watching for changes is not supported on this platform")
+}
+
+func (w *Watcher) add(d dir) error {
+	return nil
+}
+
+// Run closes fileEvents when ctx is cancelled
+func (w *Watcher) Run(ctx context.Context, fileEvents chan<- FileEvent, opts WalkOptions) {
+	<-ctx.Done()
+	close(fileEvents)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"os"
@@ -14,14 +15,73 @@ import (
 )
 
 func main() {
-	path, debug := app.ArgsOrExit()
-	logging.Setup(debug)
+	args := app.ArgsOrExit()
+	logging.Setup(args.Debug)
 
 	fileEvents := make(chan files.FileEvent)
 	stateEvents := make(chan dux.StateEvent, 1)
 	commands := make(chan dux.Command, 1)
 
-	initState := dux.State{}
+	walkOpts := files.WalkOptions{
+		ReadDir:        os.ReadDir,
+		Jobs:           args.Jobs,
+		CountLinks:     args.CountLinks,
+		OneFileSystem:  args.OneFileSystem,
+		Exclude:        args.Exclude,
+		GitIgnore:      args.GitIgnore,
+		FollowSymlinks: args.FollowSymlinks,
+		Throttle:       files.NewThrottle(args.MaxIOPS),
+		// shared by the walks of the watcher and of rescans
+		Inodes: files.NewInodes(),
+	}
+	var watchEvents chan files.FileEvent
+	if args.Watch {
+		watcher, err := files.NewWatcher()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		walkOpts.Watch = watcher
+		watchEvents = make(chan files.FileEvent)
+	}
+
+	var snapshot *files.Snapshot
+	if args.Load != "" {
+		snapshot = openSnapshotOrExit(args.Load)
+	}
+	var ncduExport, duOutput *os.File
+	if args.ImportNcdu != "" {
+		ncduExport = openInputOrExit(args.ImportNcdu)
+	}
+	if args.FromDu != "" {
+		duOutput = openInputOrExit(args.FromDu)
+	}
+	var previousSave, saveFile *os.File
+	if args.IsScanning() {
+		walkOpts.Progress = files.NewProgress()
+		previousSave, _ = os.Open(args.Save)
+	}
+	if args.Save != "" {
+		// a new file, so that the snapshot saved over can still be read
+		_ = os.Remove(args.Save)
+		var err error
+		saveFile, err = os.Create(args.Save)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	initState := dux.State{
+		SizeMode:       args.SizeMode,
+		SortKey:        args.SortKey,
+		IsWalkingFiles: true,
+		IsWatching:     args.Watch,
+		IsImported:     !args.IsScanning(),
+	}
+	if snapshot != nil {
+		initState.SnapshotTime = snapshot.ScanTime
+	}
 	shutdownCtx, shutdownFunc := context.WithCancel(context.Background())
 	go app.SignalHandler(commands, shutdownFunc)
 
@@ -29,19 +89,54 @@ func main() {
 		shutdownCtx,
 		shutdownFunc,
 		fileEvents,
+		watchEvents,
 		commands,
 		stateEvents,
 		initState,
 		tiling.WithPadding(tiling.SliceAndDice{}, tiling.Padding{Top: 1, Right: 1, Bottom: 1, Left: 1}),
-		files.NewFS(),
+		files.NewFSWithOptions(files.FSOptions{
+			SummarizeBelow: args.SummarizeBelow,
+			Order:          files.Order{Key: args.SortKey, SizeMode: args.SizeMode},
+		}),
+		walkOpts,
 	)
-	app := app.NewApp(shutdownCtx, path, stateEvents, commands)
+	if args.ExportNcdu != "" {
+		commands <- dux.ExportNcdu{File: args.ExportNcdu, Whole: true}
+	}
+	app := app.NewApp(shutdownCtx, args.Paths, stateEvents, commands)
 
 	rec := recovery.New(shutdownFunc)
 	rec.Go(pres.Loop)
+	if walkOpts.Progress != nil {
+		rec.Go(func() {
+			expectDiskUsage(args, previousSave, walkOpts.Progress)
+		})
+	}
+	walkEvents := fileEvents
+	if saveFile != nil {
+		walkEvents = make(chan files.FileEvent)
+		rec.Go(func() {
+			files.RecordSnapshot(shutdownCtx, saveFile, walkEvents, fileEvents)
+			saveFile.Close()
+		})
+	}
 	rec.Go(func() {
-		files.WalkDir(shutdownCtx, path, fileEvents, os.ReadDir)
+		switch {
+		case snapshot != nil:
+			snapshot.Load(shutdownCtx, walkEvents)
+		case ncduExport != nil:
+			files.ImportNcdu(shutdownCtx, bufio.NewReader(ncduExport), walkEvents)
+		case duOutput != nil:
+			files.ReadDu(shutdownCtx, duOutput, args.DuBlockSize, args.DuDirsOnly, walkEvents)
+		default:
+			files.WalkPaths(shutdownCtx, args.Paths, walkEvents, walkOpts)
+		}
 	})
+	if walkOpts.Watch != nil {
+		rec.Go(func() {
+			walkOpts.Watch.Run(shutdownCtx, watchEvents, walkOpts)
+		})
+	}
 	err := app.Run()
 	rec.Release()
 
@@ -50,3 +145,53 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// expectDiskUsage sets the disk usage that scanning is expected to find, from
+// previous, the snapshot of an earlier scan being saved over, if any, or else
+// from the filesystems scanned, if whole. Reading the snapshot takes as long
+// as loading it, so this is done while scanning.
+func expectDiskUsage(args app.Args, previous *os.File, progress *files.Progress) {
+	if previous != nil {
+		defer previous.Close()
+		if snapshot, err := files.OpenSnapshot(bufio.NewReader(previous)); err == nil {
+			if used, ok := snapshot.DiskUsage(args.Paths); ok {
+				progress.SetExpected(used)
+				return
+			}
+		}
+	}
+	if args.Exclude.Len() > 0 || args.GitIgnore {
+		// excluded files are in use, but not found
+		return
+	}
+	if used, ok := files.FilesystemUsage(args.Paths); ok {
+		progress.SetExpected(used)
+	}
+}
+
+// openInputOrExit opens path for reading, or stdin for "-"
+func openInputOrExit(path string) *os.File {
+	if path == "-" {
+		return os.Stdin
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	return f
+}
+
+func openSnapshotOrExit(path string) *files.Snapshot {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	snapshot, err := files.OpenSnapshot(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot load '%s': %v\n", path, err)
+		os.Exit(1)
+	}
+	return snapshot
+}
@@ -103,6 +103,8 @@ func stepVertical[T treemap.Rect](tm *treemap.Treemap[T], getSibling adjacentSib
 	return nil
 }
 
+// stepIn steps to the first child, which is the largest unless the files are
+// sorted by other than size, see files.Order
 func stepIn[T treemap.Rect](tm *treemap.Treemap[T]) *treemap.Treemap[T] {
 	if len(tm.Children) > 0 {
 		return tm.Children[0]
@@ -15,9 +15,13 @@ const (
 
 // Tiler arranges rectangular area into smaller rects with adjoining edges. The
 // number of output tiles must match len(weights), and the area of each rect
-// should depend on its relative weight.
+// should depend on its relative weight, as given by the size selected by mode.
+// Mount points of other filesystems get the minimum size of a tile where there
+// is room, as they have no size of their own.
+// Children are tiled in the order of fileTree.Children, which files.FS keeps
+// sorted by its files.Order, the largest first by default.
 type Tiler interface {
-	Tile(rect r2.Rect, fileTree files.FileTree, depth int) (tiles []Tile, spillage r2.Rect)
+	Tile(rect r2.Rect, fileTree files.FileTree, depth int, mode files.SizeMode) (tiles []Tile, spillage r2.Rect)
 }
 
 type Tile struct {
@@ -27,15 +31,14 @@ type Tile struct {
 
 type VerticalSplit struct{}
 
-func (VerticalSplit) Tile(rect r2.Rect, fileTree files.FileTree, depth int) (tiles []Tile, spillage r2.Rect) {
+func (VerticalSplit) Tile(rect r2.Rect, fileTree files.FileTree, depth int, mode files.SizeMode) (tiles []Tile, spillage r2.Rect) {
 	tiles = []Tile{}
 
-	totalWeight := float64(fileTree.File().Size)
+	children := fileTree.Children()
+	widths := extents(fileTree, rect.Size().X, MINIMUM_WIDTH, mode)
 	nextMinX := rect.Lo().X
-	for _, ftree := range fileTree.Children() {
-		weightFactor := float64(ftree.File().Size) / totalWeight
-		size := rect.Size()
-		dx := weightFactor * float64(size.X)
+	for i, ftree := range children {
+		dx := widths[i]
 		candidate := r2.Rect{
 			X: r1.Interval{Lo: nextMinX, Hi: nextMinX + dx},
 			Y: rect.Y,
@@ -55,15 +58,14 @@ func (VerticalSplit) Tile(rect r2.Rect, fileTree files.FileTree, depth int) (til
 
 type HorizontalSplit struct{}
 
-func (HorizontalSplit) Tile(rect r2.Rect, fileTree files.FileTree, depth int) (tiles []Tile, spillage r2.Rect) {
+func (HorizontalSplit) Tile(rect r2.Rect, fileTree files.FileTree, depth int, mode files.SizeMode) (tiles []Tile, spillage r2.Rect) {
 	tiles = []Tile{}
 
-	totalWeight := float64(fileTree.File().Size)
+	children := fileTree.Children()
+	heights := extents(fileTree, rect.Size().Y, MINIMUM_HEIGHT, mode)
 	nextMinY := rect.Lo().Y
-	for _, ftree := range fileTree.Children() {
-		weightFactor := float64(ftree.File().Size) / totalWeight
-		size := rect.Size()
-		dy := weightFactor * float64(size.Y)
+	for i, ftree := range children {
+		dy := heights[i]
 		candidate := r2.Rect{
 			X: rect.X,
 			Y: r1.Interval{Lo: nextMinY, Hi: nextMinY + dy},
@@ -80,17 +82,47 @@ func (HorizontalSplit) Tile(rect r2.Rect, fileTree files.FileTree, depth int) (t
 	return tiles, spillage
 }
 
+// extents splits length between the children of fileTree by their size.
+// Mount points of other filesystems, which are not walked and have no size,
+// get the minimum length of a tile instead, so that they are seen, as long as
+// at least half of length is left for the others.
+func extents(fileTree files.FileTree, length float64, minimum float64, mode files.SizeMode) []float64 {
+	children := fileTree.Children()
+	weights := make([]float64, len(children))
+	isMountPoint := make([]bool, len(children))
+	reserved := 0.0
+	for i, ftree := range children {
+		f := ftree.File()
+		weights[i] = float64(f.SizeOf(mode))
+		if f.Excluded == files.ExcludedOtherFS && reserved+minimum <= length/2 {
+			isMountPoint[i] = true
+			reserved += minimum
+		}
+	}
+
+	totalWeight := float64(fileTree.File().SizeOf(mode))
+	extents := make([]float64, len(children))
+	for i := range children {
+		if isMountPoint[i] {
+			extents[i] = minimum
+			continue
+		}
+		extents[i] = weights[i] / totalWeight * (length - reserved)
+	}
+	return extents
+}
+
 // SliceAndDice alternates between HorizontalSplit and VerticalSplit based on depth
 type SliceAndDice struct{}
 
-func (sd SliceAndDice) Tile(rect r2.Rect, fileTree files.FileTree, depth int) (tiles []Tile, spillage r2.Rect) {
+func (sd SliceAndDice) Tile(rect r2.Rect, fileTree files.FileTree, depth int, mode files.SizeMode) (tiles []Tile, spillage r2.Rect) {
 	var tiler Tiler
 	if depth%2 == 0 {
 		tiler = HorizontalSplit{}
 	} else {
 		tiler = VerticalSplit{}
 	}
-	return tiler.Tile(rect, fileTree, depth)
+	return tiler.Tile(rect, fileTree, depth, mode)
 }
 
 type Padding struct {
@@ -114,8 +146,8 @@ type paddingTiler struct {
 	padding Padding
 }
 
-func (p paddingTiler) Tile(rect r2.Rect, fileTree files.FileTree, depth int) (tiles []Tile, spillage r2.Rect) {
-	return p.tiler.Tile(p.padding.pad(rect), fileTree, depth)
+func (p paddingTiler) Tile(rect r2.Rect, fileTree files.FileTree, depth int, mode files.SizeMode) (tiles []Tile, spillage r2.Rect) {
+	return p.tiler.Tile(p.padding.pad(rect), fileTree, depth, mode)
 }
 
 func WithPadding(tiler Tiler, widths Padding) Tiler {
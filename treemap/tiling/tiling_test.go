@@ -103,7 +103,7 @@ func TestSliceAndDice_SliceOrientationDependsOnDepth(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tiler := SliceAndDice{}
-			gotTiles, gotSpillage := tiler.Tile(square, *fileTree, tt.depth)
+			gotTiles, gotSpillage := tiler.Tile(square, *fileTree, tt.depth, files.ApparentSize)
 			if len(gotTiles) == 0 {
 				t.Errorf("no tiles")
 			}
@@ -118,3 +118,61 @@ func TestSliceAndDice_SliceOrientationDependsOnDepth(t *testing.T) {
 		})
 	}
 }
+
+func TestSplit_ShowsMountPointsOfOtherFilesystems(t *testing.T) {
+	square := r2.RectFromPoints(
+		r2.Point{X: 0.0, Y: 0.0},
+		r2.Point{X: 100.0, Y: 100.0},
+	)
+	fileTree := files.NewFileTree(files.File{Size: 100, IsDir: true})
+	fileTree.AddChildren(
+		files.NewFileTree(files.File{Path: "big", Size: 100}),
+		files.NewFileTree(files.File{Path: "mnt", IsDir: true, Excluded: files.ExcludedOtherFS}),
+	)
+
+	tests := []struct {
+		name  string
+		tiler Tiler
+		want  r2.Rect
+	}{
+		{"vertical split", VerticalSplit{}, r2.RectFromPoints(
+			r2.Point{X: 100.0 - MINIMUM_WIDTH, Y: 0.0},
+			r2.Point{X: 100.0, Y: 100.0},
+		)},
+		{"horizontal split", HorizontalSplit{}, r2.RectFromPoints(
+			r2.Point{X: 0.0, Y: 100.0 - MINIMUM_HEIGHT},
+			r2.Point{X: 100.0, Y: 100.0},
+		)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotTiles, _ := tt.tiler.Tile(square, *fileTree, 0, files.ApparentSize)
+			if len(gotTiles) != 2 {
+				t.Fatalf("got %d tiles, want 2", len(gotTiles))
+			}
+			if path := gotTiles[1].File.File().Path; path != "mnt" {
+				t.Errorf("got tile of %q, want mnt", path)
+			}
+			if !r2.RectApproxEqual(gotTiles[1].Rect, tt.want) {
+				t.Errorf("\ngot  %v,\nwant %v", gotTiles[1].Rect, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplit_HidesMountPointsWithoutRoom(t *testing.T) {
+	narrow := r2.RectFromPoints(
+		r2.Point{X: 0.0, Y: 0.0},
+		r2.Point{X: 10.0, Y: 10.0},
+	)
+	fileTree := files.NewFileTree(files.File{Size: 100, IsDir: true})
+	fileTree.AddChildren(
+		files.NewFileTree(files.File{Path: "big", Size: 100}),
+		files.NewFileTree(files.File{Path: "mnt", IsDir: true, Excluded: files.ExcludedOtherFS}),
+	)
+
+	gotTiles, _ := VerticalSplit{}.Tile(narrow, *fileTree, 0, files.ApparentSize)
+	if len(gotTiles) != 1 || gotTiles[0].File.File().Path != "big" {
+		t.Errorf("got %v, want only the tile of big", gotTiles)
+	}
+}
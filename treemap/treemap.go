@@ -44,11 +44,11 @@ func (tm *Treemap[T]) FindNode(path string) (*Treemap[T], error) {
 	return nil, fmt.Errorf("no such node: %s", path)
 }
 
-func NewR2Treemap(root files.FileTree, rect r2.Rect, tiler tiling.Tiler, maxDepth int) *R2Treemap {
-	return newR2Treemap(nil, root, rect, tiler, maxDepth, 1)
+func NewR2Treemap(root files.FileTree, rect r2.Rect, tiler tiling.Tiler, maxDepth int, mode files.SizeMode) *R2Treemap {
+	return newR2Treemap(nil, root, rect, tiler, maxDepth, mode, 1)
 }
 
-func newR2Treemap(parent *R2Treemap, tree files.FileTree, rect r2.Rect, tiler tiling.Tiler, maxDepth int, depth int) *R2Treemap {
+func newR2Treemap(parent *R2Treemap, tree files.FileTree, rect r2.Rect, tiler tiling.Tiler, maxDepth int, mode files.SizeMode, depth int) *R2Treemap {
 	if len(tree.Children()) == 0 {
 		return &R2Treemap{Parent: parent, File: tree.File(), Rect: rect, Children: []*R2Treemap{}}
 	}
@@ -70,10 +70,10 @@ func newR2Treemap(parent *R2Treemap, tree files.FileTree, rect r2.Rect, tiler ti
 
 	if maxDepth == 0 || depth < maxDepth {
 		var tiles []tiling.Tile
-		tiles, spillage = tiler.Tile(rect, tree, depth)
+		tiles, spillage = tiler.Tile(rect, tree, depth, mode)
 		childTreemaps = make([]*R2Treemap, len(tiles))
 		for i, tile := range tiles {
-			childTreemaps[i] = newR2Treemap(treemap, tile.File, tile.Rect, tiler, maxDepth, depth+1)
+			childTreemaps[i] = newR2Treemap(treemap, tile.File, tile.Rect, tiler, maxDepth, mode, depth+1)
 		}
 
 		treemap.Children = childTreemaps